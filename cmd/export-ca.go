@@ -0,0 +1,86 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/upvestco/httpsignature-proxy/service/localca"
+)
+
+// defaultTLSDirName is the directory of the local CA next to the config file.
+const defaultTLSDirName = ".httpsignature-proxy-tls"
+
+var caOutFile string
+
+var exportCACmd = &cobra.Command{
+	Use:   "export-ca",
+	Short: "Prints the certificate of the local CA of the HTTPS listener, to be trusted by the clients",
+	Example: "  httpsignature-proxy export-ca > httpsignature-proxy-ca.pem\n" +
+		"  httpsignature-proxy export-ca --out /usr/local/share/ca-certificates/httpsignature-proxy.crt",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := exportCA(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(exportCACmd)
+
+	exportCACmd.Flags().StringVarP(&caOutFile, outDirFlag, "o", "", "file to write the CA certificate to instead of stdout")
+	exportCACmd.Flags().StringVar(&tlsDir, tlsDirFlag, "", "directory of the local CA (default "+defaultTLSDirName+" next to the config file)")
+}
+
+// exportCA writes the PEM certificate of the local CA, which is created when it does not exist yet.
+func exportCA() error {
+	dir := tlsDir
+	if dir == "" {
+		var err error
+		if dir, err = defaultTLSDir(); err != nil {
+			return err
+		}
+	}
+	ca, err := localca.LoadOrCreate(dir)
+	if err != nil {
+		return err
+	}
+	if caOutFile == "" {
+		_, err := os.Stdout.Write(ca.CertificatePEM())
+		return err
+	}
+	if err := os.WriteFile(caOutFile, ca.CertificatePEM(), 0o644); err != nil {
+		return errors.Wrap(err, "write CA certificate")
+	}
+	fmt.Printf("CA certificate written to %s\n", caOutFile)
+	return nil
+}
+
+// defaultTLSDir returns the directory of the local CA next to the config file.
+func defaultTLSDir() (string, error) {
+	configFile, err := configFileName()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configFile), defaultTLSDirName), nil
+}
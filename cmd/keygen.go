@@ -0,0 +1,271 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+	"golang.org/x/term"
+
+	"github.com/upvestco/httpsignature-proxy/service/signer"
+)
+
+const (
+	keyTypeFlag     = "type"
+	outDirFlag      = "out"
+	addToConfigFlag = "add-to-config"
+
+	keyConfigsKey = "key-configs"
+)
+
+var (
+	keyType     string
+	outDir      string
+	addToConfig bool
+)
+
+// keyFileNames are the names of the private and public key files by key type.
+var keyFileNames = map[string][2]string{
+	signer.KeyTypeECDSA:   {"ec-encr-priv-key.pem", "ec-pub-key.pem"},
+	signer.KeyTypeEd25519: {"ed25519.pem", "ed25519.pub"},
+}
+
+var keygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generates a password protected key pair for the HTTP signatures",
+	Example: "  httpsignature-proxy keygen --type ed25519 --out ./keys\n" +
+		"  httpsignature-proxy keygen --type ecdsa --out ./keys --add-to-config --client-id <client id> --key-id <key id> --server-base-url https://sandbox.upvest.co",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := generateKeys(); err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(keygenCmd)
+
+	keygenCmd.Flags().StringVarP(&keyType, keyTypeFlag, "t", signer.KeyTypeEd25519, "key type: "+strings.Join(signer.KeyTypes(), ", "))
+	keygenCmd.Flags().StringVarP(&outDir, outDirFlag, "o", ".", "directory of the generated key files")
+	keygenCmd.Flags().StringVar(&passwordFile, privateKeyPasswordFileFlag, "", "file with the password of the private key")
+	keygenCmd.Flags().StringVar(&passwordCommand, privateKeyPasswordCommandFlag, "", "shell command printing the password of the private key, e.g. of a password manager")
+	keygenCmd.Flags().BoolVar(&addToConfig, addToConfigFlag, false, "append a key config with the private key to the config file")
+	keygenCmd.Flags().StringVarP(&clientID, clientIDFlag, "c", "", "client id of the appended key config")
+	keygenCmd.Flags().StringVarP(&keyID, keyIDFlag, "i", "", "key id of the appended key config, as shown by Upvest for the uploaded public key")
+	keygenCmd.Flags().StringVarP(&serverBaseUrl, serverBaseUrlFlag, "s", "", "server base URL of the appended key config")
+}
+
+func generateKeys() error {
+	names, ok := keyFileNames[keyType]
+	if !ok {
+		return errors.WithMessage(signer.ErrUnsupportedKeyType, keyType)
+	}
+	if addToConfig && (clientID == "" || keyID == "" || serverBaseUrl == "") {
+		return errors.Errorf("--%s needs --%s, --%s and --%s", addToConfigFlag, clientIDFlag, keyIDFlag, serverBaseUrlFlag)
+	}
+	privateKeyFile := filepath.Join(outDir, names[0])
+	publicKeyFile := filepath.Join(outDir, names[1])
+	for _, name := range []string{privateKeyFile, publicKeyFile} {
+		if _, err := os.Stat(name); err == nil {
+			return errors.Errorf("%s already exists", name)
+		}
+	}
+
+	password, err := signer.ReadPassword(passwordFile, passwordCommand)
+	if err != nil {
+		return err
+	}
+	if password == "" {
+		if password, err = promptNewPassword(); err != nil {
+			return err
+		}
+	}
+	pair, err := signer.GenerateKeyPair(keyType, password)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(outDir, 0o700); err != nil {
+		return errors.Wrap(err, "create output directory")
+	}
+	if err := os.WriteFile(privateKeyFile, pair.PrivateKey, 0o600); err != nil {
+		return errors.Wrap(err, "write private key")
+	}
+	if err := os.WriteFile(publicKeyFile, pair.PublicKey, 0o644); err != nil {
+		return errors.Wrap(err, "write public key")
+	}
+	fmt.Printf("Private key written to %s\n", privateKeyFile)
+	fmt.Printf("Public key written to %s, upload it to Upvest:\n\n%s\n", publicKeyFile, pair.PublicKey)
+
+	if addToConfig {
+		configFile, err := configFileName()
+		if err != nil {
+			return err
+		}
+		name, err := appendKeyConfig(configFile, privateKeyFile, passwordFile)
+		if err != nil {
+			return errors.Wrapf(err, "append key config to %s", configFile)
+		}
+		fmt.Printf("Key config %s appended to %s\n", name, configFile)
+	}
+	return nil
+}
+
+// promptNewPassword asks for the password of the new key twice, it needs a terminal.
+func promptNewPassword() (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.Errorf("stdin is not a terminal, use --%s or --%s", privateKeyPasswordFileFlag, privateKeyPasswordCommandFlag)
+	}
+	password, err := promptPassword("new private key")
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", signer.ErrNoPassword
+	}
+	repeated, err := promptPassword("new private key again")
+	if err != nil {
+		return "", err
+	}
+	if password != repeated {
+		return "", errors.New("passwords do not match")
+	}
+	return password, nil
+}
+
+// configFileName returns the --config file or the config file the proxy finds in the home directory,
+// with any extension. A new one is created as .httpsignature-proxy.yaml. Only YAML files are edited.
+func configFileName() (string, error) {
+	name := cfgFile
+	if name == "" {
+		name = viper.ConfigFileUsed()
+	}
+	if name == "" {
+		v := viper.New()
+		if err := searchConfig(v); err != nil {
+			return "", err
+		}
+		var notFound viper.ConfigFileNotFoundError
+		if err := v.ReadInConfig(); errors.As(err, &notFound) {
+			home, err := homedir.Dir()
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(home, configName+".yaml"), nil
+		}
+		name = v.ConfigFileUsed()
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", "":
+		return name, nil
+	}
+	return "", errors.Errorf("%s is not a YAML file, add the key config by hand", name)
+}
+
+// appendKeyConfig adds the next config-N entry to the key-configs of the YAML config file, the
+// rest of the file, including the comments, stays as it is. The password is not written: the
+// proxy reads it with the password file or command when one is given and prompts for it otherwise.
+func appendKeyConfig(configFile, privateKeyFile, passwordFile string) (string, error) {
+	var err error
+	if privateKeyFile, err = filepath.Abs(privateKeyFile); err != nil {
+		return "", err
+	}
+	if passwordFile != "" {
+		if passwordFile, err = filepath.Abs(passwordFile); err != nil {
+			return "", err
+		}
+	}
+	data, err := os.ReadFile(configFile)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return "", errors.Wrap(err, "parse config file")
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return "", errors.New("config file is not a YAML map")
+	}
+	keyConfigsNode := mappingValue(root, keyConfigsKey)
+	if keyConfigsNode == nil {
+		keyConfigsNode = &yaml.Node{Kind: yaml.MappingNode}
+		root.Content = append(root.Content, scalarNode(keyConfigsKey), keyConfigsNode)
+	}
+	if keyConfigsNode.Kind != yaml.MappingNode {
+		return "", errors.Errorf("%s is not a YAML map", keyConfigsKey)
+	}
+	name := ""
+	for i := 1; ; i++ {
+		if name = fmt.Sprintf("config-%d", i); mappingValue(keyConfigsNode, name) == nil {
+			break
+		}
+	}
+
+	entry := &yaml.Node{Kind: yaml.MappingNode}
+	fields := [][2]string{
+		{clientIDFlag, clientID},
+		{keyIDFlag, keyID},
+		{privateKeyFileNameFlag, privateKeyFile},
+		{privateKeyPasswordFileFlag, passwordFile},
+		{privateKeyPasswordCommandFlag, passwordCommand},
+		{serverBaseUrlFlag, serverBaseUrl},
+	}
+	for _, field := range fields {
+		if field[1] != "" {
+			entry.Content = append(entry.Content, scalarNode(field[0]), scalarNode(field[1]))
+		}
+	}
+	keyConfigsNode.Content = append(keyConfigsNode.Content, scalarNode(name), entry)
+
+	out := new(bytes.Buffer)
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return "", errors.Wrap(err, "encode config file")
+	}
+	if err := enc.Close(); err != nil {
+		return "", errors.Wrap(err, "encode config file")
+	}
+	return name, os.WriteFile(configFile, out.Bytes(), 0o600)
+}
+
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendKeyConfig(t *testing.T) {
+	clientID, keyID, serverBaseUrl = testClientID, "new key", "https://sandbox.upvest.co"
+	defer func() {
+		clientID, keyID, serverBaseUrl = "", "", ""
+	}()
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		existing string
+		comments []string
+		expected string
+	}{
+		{
+			name:     "new file",
+			expected: "config-1",
+		},
+		{
+			name:     "existing key configs with comments",
+			existing: "# proxy settings\nport: 3000\nkey-configs:\n  config-1: # sandbox\n    key-id: \"a\"\n  config-2:\n    key-id: \"b\"\n",
+			comments: []string{"# proxy settings", "# sandbox"},
+			expected: "config-3",
+		},
+		{
+			name:     "first free slot",
+			existing: "key-configs:\n  config-1:\n    key-id: \"a\"\n  config-3:\n    key-id: \"c\"\n",
+			expected: "config-2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), "config.yaml")
+			if tt.existing != "" {
+				require.NoError(t, os.WriteFile(configFile, []byte(tt.existing), 0o600))
+			}
+
+			name, err := appendKeyConfig(configFile, filepath.Join(dir, "key.pem"), "")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, name)
+
+			v := viper.New()
+			v.SetConfigFile(configFile)
+			require.NoError(t, v.ReadInConfig())
+			assert.Equal(t, keyID, v.GetString("key-configs."+name+".key-id"))
+			assert.Equal(t, filepath.Join(dir, "key.pem"), v.GetString("key-configs."+name+".private-key"))
+			data, err := os.ReadFile(configFile)
+			require.NoError(t, err)
+			for _, comment := range tt.comments {
+				assert.Contains(t, string(data), comment)
+			}
+			if tt.existing != "" {
+				assert.Equal(t, "a", v.GetString("key-configs.config-1.key-id"))
+			}
+		})
+	}
+
+	_, err := appendKeyConfig(writeFile(t, "config.yaml", "- not a map\n"), filepath.Join(dir, "key.pem"), "")
+	assert.ErrorContains(t, err, "not a YAML map")
+}
+
+func TestConfigFileName(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	homedir.DisableCache = true
+	defer func() {
+		homedir.DisableCache = false
+	}()
+
+	name, err := configFileName()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(home, ".httpsignature-proxy.yaml"), name)
+
+	yml := filepath.Join(home, ".httpsignature-proxy.yml")
+	require.NoError(t, os.WriteFile(yml, []byte("port: 3000\n"), 0o600))
+	name, err = configFileName()
+	require.NoError(t, err)
+	assert.Equal(t, yml, name)
+
+	require.NoError(t, os.Remove(yml))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".httpsignature-proxy.json"), []byte(`{"port": 3000}`), 0o600))
+	_, err = configFileName()
+	assert.ErrorContains(t, err, "not a YAML file")
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	res := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(res, []byte(content), 0o600))
+	return res
+}
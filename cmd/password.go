@@ -0,0 +1,124 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+
+	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/signer"
+)
+
+// resolvePasswords fills the passwords of the key config from the password files and commands,
+// and prompts for the password of an encrypted key file without one when prompt is set.
+func resolvePasswords(cfg *config.BaseConfig, prompt bool) error {
+	var err error
+	if cfg.UsesLocalPrivateKey() {
+		name := privateKeyName(cfg.KeyID, cfg.PrivateKeyFileName, cfg.PrivateKeyData, cfg.PrivateKeyEnv)
+		cfg.Password, cfg.PasswordPrompted, err = resolvePassword(cfg.Password, cfg.PasswordPrompted, cfg.PasswordFile, cfg.PasswordCommand, name, prompt, func() ([]byte, error) {
+			return signer.LoadPrivateKeyData(cfg)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "password of %s", name)
+		}
+	}
+	for i := range cfg.NextKeys {
+		key := &cfg.NextKeys[i]
+		name := privateKeyName(key.KeyID, key.PrivateKeyFileName, key.PrivateKeyData, key.PrivateKeyEnv)
+		key.Password, key.PasswordPrompted, err = resolvePassword(key.Password, key.PasswordPrompted, key.PasswordFile, key.PasswordCommand, name, prompt, func() ([]byte, error) {
+			return signer.LoadSigningKeyData(key)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "password of %s", name)
+		}
+	}
+	return nil
+}
+
+// reusePasswords takes over the prompted passwords of the previous key config on a reload,
+// as long as the key source is the same and no other password source is configured. A password
+// from the configuration is not reused, once it is removed the key has no password.
+func reusePasswords(cfg, previous *config.BaseConfig) {
+	if cfg.Password == "" && cfg.PasswordFile == "" && cfg.PasswordCommand == "" && previous.PasswordPrompted &&
+		cfg.PrivateKeyFileName == previous.PrivateKeyFileName &&
+		cfg.PrivateKeyData == previous.PrivateKeyData && cfg.PrivateKeyEnv == previous.PrivateKeyEnv {
+		cfg.Password, cfg.PasswordPrompted = previous.Password, true
+	}
+	for i := range cfg.NextKeys {
+		key := &cfg.NextKeys[i]
+		if key.Password != "" || key.PasswordFile != "" || key.PasswordCommand != "" {
+			continue
+		}
+		for _, prev := range previous.NextKeys {
+			if prev.PasswordPrompted && prev.PrivateKeyFileName == key.PrivateKeyFileName &&
+				prev.PrivateKeyData == key.PrivateKeyData && prev.PrivateKeyEnv == key.PrivateKeyEnv {
+				key.Password, key.PasswordPrompted = prev.Password, true
+			}
+		}
+	}
+}
+
+// privateKeyName describes the source of the private key in the messages.
+func privateKeyName(keyID, fileName, data, env string) string {
+	switch {
+	case data != "":
+		return "private key data of keyID " + keyID
+	case env != "":
+		return "private key env " + env
+	}
+	return fileName
+}
+
+// resolvePassword returns the password and whether it was entered on the prompt.
+func resolvePassword(password string, prompted bool, passwordFile, passwordCommand, keyName string, prompt bool, keyData func() ([]byte, error)) (string, bool, error) {
+	if password != "" {
+		return password, prompted, nil
+	}
+	password, err := signer.ReadPassword(passwordFile, passwordCommand)
+	if err != nil || password != "" {
+		return password, false, err
+	}
+	if !prompt {
+		return "", false, nil
+	}
+	data, err := keyData()
+	if err != nil || !signer.KeyNeedsPassword(data) {
+		// the key builder reports the unreadable key
+		return "", false, nil
+	}
+	password, err = promptPassword(keyName)
+	return password, password != "", err
+}
+
+// promptPassword reads the password without echo, it does not prompt when stdin is not a terminal.
+func promptPassword(keyName string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", nil
+	}
+	fmt.Fprintf(os.Stderr, "Password for the %s: ", keyName)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", errors.Wrap(err, "read password")
+	}
+	return string(password), nil
+}
@@ -0,0 +1,222 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+
+	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/logger"
+	"github.com/upvestco/httpsignature-proxy/service/runtime"
+	"github.com/upvestco/httpsignature-proxy/service/tunnels"
+)
+
+// reloadDelay collects the bursts of file events, e.g. an editor writing a file in several steps.
+const reloadDelay = 500 * time.Millisecond
+
+// atomicDataDir is the symlink which Kubernetes swaps to update the files of a mounted secret or
+// config map, the files are symlinks through it.
+const atomicDataDir = "..data"
+
+// flagKeyConfig is the key config given by the command line flags, a reload keeps it.
+var flagKeyConfig config.KeyConfig
+
+// reloader rebuilds the signers when the config file or a key file changes and on SIGHUP.
+// The new signers replace the running ones only when all of them are valid.
+type reloader struct {
+	cfg     *config.Config
+	proxy   *runtime.Proxy
+	tnls    *tunnels.Tunnels
+	log     logger.Logger
+	current map[string]runtime.SignerConfig
+	watcher *fsnotify.Watcher
+	files   map[string]struct{}
+	dirs    map[string]struct{}
+}
+
+// startReloading watches the configuration until the process exits. The tunnels may be nil.
+func startReloading(cfg *config.Config, proxy *runtime.Proxy, tnls *tunnels.Tunnels, signerConfigs map[string]runtime.SignerConfig, ll logger.Logger) {
+	r := &reloader{cfg: cfg, proxy: proxy, tnls: tnls, log: ll, current: signerConfigs}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		ll.PrintF("Warning: failed to watch the configuration files, reload with SIGHUP only: %s\n", err.Error())
+	} else {
+		r.watcher = watcher
+		r.watch(cfg.KeyConfigs)
+	}
+	go r.run()
+}
+
+// run reloads on SIGHUP and on the changes of the watched files until the watcher is closed.
+func (r *reloader) run() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var events chan fsnotify.Event
+	var watchErrors chan error
+	if r.watcher != nil {
+		events, watchErrors = r.watcher.Events, r.watcher.Errors
+	}
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	changed := ""
+	for {
+		select {
+		case <-hup:
+			r.reload("SIGHUP")
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if !r.relevant(event) {
+				continue
+			}
+			changed = event.Name
+			timer.Reset(reloadDelay)
+		case err, ok := <-watchErrors:
+			if !ok {
+				return
+			}
+			r.log.LogF("watching the configuration files: %s", err.Error())
+		case <-timer.C:
+			r.reload(changed + " changed")
+		}
+	}
+}
+
+func (r *reloader) reload(reason string) {
+	r.log.PrintF("Reloading the configuration: %s\n", reason)
+	keyConfigs, signerConfigs, err := r.load()
+	if err != nil {
+		r.log.PrintF("Reload failed, keeping the current configuration: %s\n", err.Error())
+		return
+	}
+	changes := r.proxy.Reload(signerConfigs)
+	if r.tnls != nil {
+		r.tnls.SetVerifiers(webhookVerifiers(signerConfigs))
+	}
+	r.current = signerConfigs
+	if r.watcher != nil {
+		r.watch(keyConfigs)
+	}
+	r.log.PrintF("Configuration reloaded: %s\n", changes.String())
+}
+
+func (r *reloader) load() ([]config.KeyConfig, map[string]runtime.SignerConfig, error) {
+	if viper.ConfigFileUsed() != "" {
+		if err := viper.ReadInConfig(); err != nil {
+			return nil, nil, errors.Wrap(err, "read config file")
+		}
+	}
+	keyConfigs, err := readKeyConfigs()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !flagKeyConfig.IsEmpty() {
+		keyConfigs = append(keyConfigs, cloneKeyConfig(flagKeyConfig))
+	}
+	signerConfigs, err := buildSignerConfigs(keyConfigs, r.cfg.DefaultTimeout, r.current)
+	if err != nil {
+		return nil, nil, err
+	}
+	return keyConfigs, signerConfigs, nil
+}
+
+// relevant reports the events which change a watched file: a write, create, rename or remove of the
+// file or of its symlink target, or the swap of the ..data symlink of a Kubernetes volume.
+func (r *reloader) relevant(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	name := filepath.Clean(event.Name)
+	if _, ok := r.files[name]; ok {
+		return true
+	}
+	if filepath.Base(name) == atomicDataDir {
+		_, ok := r.dirs[filepath.Dir(name)]
+		return ok
+	}
+	return false
+}
+
+// watch watches the directories of the config file and the key files, so the files replaced
+// by a rename, e.g. by editors, are noticed as well. The symlinks are resolved and their targets
+// watched too, as the mounted Kubernetes secrets and config maps update the files through them.
+func (r *reloader) watch(keyConfigs []config.KeyConfig) {
+	if r.dirs == nil {
+		r.dirs = make(map[string]struct{})
+	}
+	r.files = make(map[string]struct{})
+	for _, name := range watchedFiles(viper.ConfigFileUsed(), keyConfigs) {
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			continue
+		}
+		r.watchFile(abs)
+		if target, err := filepath.EvalSymlinks(abs); err == nil && target != abs {
+			r.watchFile(target)
+		}
+	}
+}
+
+func (r *reloader) watchFile(name string) {
+	r.files[name] = struct{}{}
+	dir := filepath.Dir(name)
+	if _, ok := r.dirs[dir]; ok {
+		return
+	}
+	if err := r.watcher.Add(dir); err != nil {
+		r.log.PrintF("Warning: failed to watch %s: %s\n", dir, err.Error())
+		return
+	}
+	r.dirs[dir] = struct{}{}
+}
+
+// watchedFiles returns the config file and the files referenced by the key configs.
+func watchedFiles(configFile string, keyConfigs []config.KeyConfig) []string {
+	res := make([]string, 0)
+	add := func(names ...string) {
+		for _, name := range names {
+			if name != "" {
+				res = append(res, name)
+			}
+		}
+	}
+	add(configFile)
+	for _, keyConfig := range keyConfigs {
+		add(keyConfig.PrivateKeyFileName, keyConfig.PasswordFile, keyConfig.WebhookPublicKeyFileName)
+		for _, key := range keyConfig.NextKeys {
+			add(key.PrivateKeyFileName, key.PasswordFile)
+		}
+	}
+	return res
+}
+
+// cloneKeyConfig copies the key config, so resolving the passwords of the copy keeps the original intact.
+func cloneKeyConfig(keyConfig config.KeyConfig) config.KeyConfig {
+	keyConfig.NextKeys = append([]config.SigningKey(nil), keyConfig.NextKeys...)
+	return keyConfig
+}
@@ -0,0 +1,249 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/runtime"
+	"github.com/upvestco/httpsignature-proxy/service/signer"
+)
+
+const (
+	testClientID = "ba141d1d-086e-4bfc-972e-621b4a6ab404"
+	testPassword = "123456"
+)
+
+// recordingLogger keeps the printed lines, the reloader logs from its own goroutine.
+type recordingLogger struct {
+	lock  sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) Log(message string) {
+	l.PrintLn(message)
+}
+
+func (l *recordingLogger) LogF(format string, a ...interface{}) {
+	l.PrintLn(fmt.Sprintf(format, a...))
+}
+
+func (l *recordingLogger) PrintF(format string, a ...interface{}) {
+	l.PrintLn(fmt.Sprintf(format, a...))
+}
+
+func (l *recordingLogger) PrintLn(message string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.lines = append(l.lines, message)
+}
+
+func (l *recordingLogger) count(prefix string) int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	n := 0
+	for _, line := range l.lines {
+		if strings.HasPrefix(line, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func writeTestKey(t *testing.T, dir string) string {
+	t.Helper()
+	pair, err := signer.GenerateKeyPair(signer.KeyTypeEd25519, testPassword)
+	require.NoError(t, err)
+	name := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(name, pair.PrivateKey, 0o600))
+	return name
+}
+
+func testConfigFile(keyFile, keyID, password string) string {
+	res := "key-configs:\n  config-1:\n" +
+		"    client-id: \"" + testClientID + "\"\n" +
+		"    private-key: \"" + keyFile + "\"\n" +
+		"    server-base-url: \"http://localhost\"\n"
+	if keyID != "" {
+		res += "    key-id: \"" + keyID + "\"\n"
+	}
+	if password != "" {
+		res += "    private-key-password: \"" + password + "\"\n"
+	}
+	return res
+}
+
+// newTestReloader loads the config file like the start command, the prompted password is
+// set on the key configs.
+func newTestReloader(t *testing.T, configFile, password string) (*reloader, *recordingLogger) {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.SetConfigFile(configFile)
+	require.NoError(t, viper.ReadInConfig())
+
+	keyConfigs, err := readKeyConfigs()
+	require.NoError(t, err)
+	for i := range keyConfigs {
+		if keyConfigs[i].Password == "" && password != "" {
+			keyConfigs[i].Password, keyConfigs[i].PasswordPrompted = password, true
+		}
+	}
+	cfg := &config.Config{DefaultTimeout: time.Second}
+	signerConfigs, err := buildSignerConfigs(keyConfigs, cfg.DefaultTimeout, nil)
+	require.NoError(t, err)
+
+	ll := &recordingLogger{}
+	proxy := runtime.NewProxy(cfg, signerConfigs, nil, ll)
+	return &reloader{cfg: cfg, proxy: &proxy, log: ll, current: signerConfigs}, ll
+}
+
+func TestReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := writeTestKey(t, dir)
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(testConfigFile(keyFile, "key-1", "")), 0o600))
+	r, ll := newTestReloader(t, configFile, testPassword)
+
+	// the prompted password is reused for the same key file
+	require.NoError(t, os.WriteFile(configFile, []byte(testConfigFile(keyFile, "key-2", "")), 0o600))
+	r.reload("test")
+	assert.Equal(t, 1, ll.count("Configuration reloaded"))
+	assert.Equal(t, "key-2", r.current[testClientID].KeyConfig.KeyID)
+	assert.Equal(t, testPassword, r.current[testClientID].KeyConfig.Password)
+
+	// a failed reload keeps the current configuration
+	require.NoError(t, os.WriteFile(configFile, []byte(testConfigFile(keyFile, "", "")), 0o600))
+	r.reload("test")
+	assert.Equal(t, 1, ll.count("Reload failed"))
+	assert.Equal(t, "key-2", r.current[testClientID].KeyConfig.KeyID)
+
+	// the password is not reused for another key file
+	otherDir := t.TempDir()
+	otherKey := writeTestKey(t, otherDir)
+	require.NoError(t, os.WriteFile(configFile, []byte(testConfigFile(otherKey, "key-3", "")), 0o600))
+	r.reload("test")
+	assert.Equal(t, 2, ll.count("Reload failed"))
+	assert.Equal(t, keyFile, r.current[testClientID].KeyConfig.PrivateKeyFileName)
+}
+
+func TestReloader_ReloadRemovedPassword(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := writeTestKey(t, dir)
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(testConfigFile(keyFile, "key-1", testPassword)), 0o600))
+	r, ll := newTestReloader(t, configFile, "")
+	assert.False(t, r.current[testClientID].KeyConfig.PasswordPrompted)
+
+	// the password removed from the config file is not kept
+	require.NoError(t, os.WriteFile(configFile, []byte(testConfigFile(keyFile, "key-2", "")), 0o600))
+	r.reload("test")
+	assert.Equal(t, 1, ll.count("Reload failed"))
+	assert.Equal(t, "key-1", r.current[testClientID].KeyConfig.KeyID)
+}
+
+func TestReloader_Relevant(t *testing.T) {
+	r := &reloader{
+		files: map[string]struct{}{"/etc/proxy/config.yaml": {}, "/keys/key.pem": {}},
+		dirs:  map[string]struct{}{"/etc/proxy": {}, "/keys": {}},
+	}
+	tests := []struct {
+		name     string
+		op       fsnotify.Op
+		expected bool
+	}{
+		{name: "/etc/proxy/config.yaml", op: fsnotify.Write, expected: true},
+		{name: "/keys/key.pem", op: fsnotify.Rename, expected: true},
+		{name: "/keys/key.pem", op: fsnotify.Chmod, expected: false},
+		{name: "/keys/other.pem", op: fsnotify.Create, expected: false},
+		{name: "/etc/proxy/..data", op: fsnotify.Create, expected: true},
+		{name: "/tmp/..data", op: fsnotify.Create, expected: false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, r.relevant(fsnotify.Event{Name: tt.name, Op: tt.op}), "%s %s", tt.op, tt.name)
+	}
+}
+
+// TestReloader_Watch updates the config file like a mounted Kubernetes config map: the file is a
+// symlink through the ..data symlink, which is swapped to a new directory.
+func TestReloader_Watch(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := writeTestKey(t, t.TempDir())
+	writeVersion := func(version, keyID string) {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, version), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, version, "config.yaml"), []byte(testConfigFile(keyFile, keyID, testPassword)), 0o600))
+		require.NoError(t, os.Symlink(version, filepath.Join(dir, "..data_tmp")))
+		require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, atomicDataDir)))
+	}
+	writeVersion("..v1", "key-1")
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.Symlink(filepath.Join(atomicDataDir, "config.yaml"), configFile))
+
+	r, ll := newTestReloader(t, configFile, "")
+	watcher, err := fsnotify.NewWatcher()
+	require.NoError(t, err)
+	r.watcher = watcher
+	keyConfigs, err := readKeyConfigs()
+	require.NoError(t, err)
+	r.watch(keyConfigs)
+	done := make(chan struct{})
+	go func() {
+		r.run()
+		close(done)
+	}()
+	defer func() {
+		_ = watcher.Close()
+		<-done
+	}()
+
+	writeVersion("..v2", "key-2")
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "..v1")))
+	require.Eventually(t, func() bool {
+		return ll.count("Configuration reloaded") == 1
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, "key-2", r.current[testClientID].KeyConfig.KeyID)
+
+	// a burst of writes is reloaded once
+	for i := 0; i < 3; i++ {
+		require.NoError(t, os.WriteFile(keyFile, mustReadFile(t, keyFile), 0o600))
+		time.Sleep(reloadDelay / 10)
+	}
+	require.Eventually(t, func() bool {
+		return ll.count("Configuration reloaded") == 2
+	}, 5*time.Second, 50*time.Millisecond)
+	time.Sleep(2 * reloadDelay)
+	assert.Equal(t, 2, ll.count("Reloading the configuration"))
+}
+
+func mustReadFile(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	return data
+}
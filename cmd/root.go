@@ -20,7 +20,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/pkg/errors"
@@ -33,6 +35,18 @@ import (
 
 const (
 	envPrefixName = "HTTP_PROXY"
+	// configName is the name of the config file in the home directory, viper finds it with any
+	// of its supported extensions.
+	configName  = ".httpsignature-proxy"
+	nextKeysKey = "next-keys"
+	routesKey   = "routes"
+
+	routePathPrefixKey        = "path-prefix"
+	routeHostKey              = "host"
+	routeHeaderKey            = "header"
+	routeHeaderValueKey       = "header-value"
+	routeRewritePathPrefixKey = "rewrite-path-prefix"
+	routeTimeoutKey           = "timeout"
 )
 
 var cfgFile string
@@ -65,13 +79,7 @@ func initConfig(cmd *cobra.Command) {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
 	} else {
-		// Find home directory.
-		home, err := homedir.Dir()
-		cobra.CheckErr(err)
-
-		// Search config in home directory with name ".httpsignature-proxy" (without extension).
-		viper.AddConfigPath(home)
-		viper.SetConfigName(".httpsignature-proxy")
+		cobra.CheckErr(searchConfig(viper.GetViper()))
 	}
 
 	viper.AutomaticEnv() // read in environment variables that match
@@ -82,6 +90,27 @@ func initConfig(cmd *cobra.Command) {
 	}
 	bindFlags(cmd)
 
+	configs, err := readKeyConfigs()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	keyConfigs = append(keyConfigs, configs...)
+}
+
+// searchConfig makes viper search the config file with configName in the home directory.
+func searchConfig(v *viper.Viper) error {
+	home, err := homedir.Dir()
+	if err != nil {
+		return err
+	}
+	v.AddConfigPath(home)
+	v.SetConfigName(configName)
+	return nil
+}
+
+// readKeyConfigs parses the key configs of the config file read by viper.
+func readKeyConfigs() ([]config.KeyConfig, error) {
+	res := make([]config.KeyConfig, 0)
 	format := "key-configs.config-%d"
 	for i := 1; ; i++ {
 		key := fmt.Sprintf(format, i)
@@ -91,24 +120,219 @@ func initConfig(cmd *cobra.Command) {
 		}
 		keyConfig, err := mapToConfig(v.AllSettings())
 		if err != nil {
-			log.Fatalf("failed to initialize key config: %s", key)
+			return nil, errors.Wrapf(err, "failed to initialize key config: %s", key)
 		}
-		keyConfigs = append(keyConfigs, keyConfig)
+		res = append(res, keyConfig)
 	}
+	return res, nil
 }
 
 func mapToConfig(m map[string]interface{}) (config.KeyConfig, error) {
+	lifetime, err := optionalDuration(m, signatureLifetimeFlag)
+	if err != nil {
+		return config.KeyConfig{}, err
+	}
+	offset, autoOffset, err := parseClockOffset(optionalString(m, clockOffsetFlag))
+	if err != nil {
+		return config.KeyConfig{}, err
+	}
+	nonceLength, err := optionalInt(m, nonceLengthFlag)
+	if err != nil {
+		return config.KeyConfig{}, err
+	}
+	nextKeys, err := signingKeys(m, nextKeysKey)
+	if err != nil {
+		return config.KeyConfig{}, err
+	}
+	routes, err := parseRoutes(m, routesKey)
+	if err != nil {
+		return config.KeyConfig{}, err
+	}
+	required := make(map[string]string)
+	for _, key := range []string{clientIDFlag, serverBaseUrlFlag, keyIDFlag} {
+		v, ok := m[key].(string)
+		if !ok {
+			return config.KeyConfig{}, errors.Errorf("%s is missing or not a string", key)
+		}
+		required[key] = v
+	}
 	return config.KeyConfig{
-		ClientID: m["client-id"].(string),
+		ClientID: required[clientIDFlag],
 		BaseConfig: config.BaseConfig{
-			PrivateKeyFileName: m["private-key"].(string),
-			Password:           m["private-key-password"].(string),
-			BaseUrl:            m["server-base-url"].(string),
-			KeyID:              m["key-id"].(string),
+			PrivateKeyFileName: optionalString(m, privateKeyFileNameFlag),
+			PrivateKeyData:     optionalString(m, privateKeyDataFlag),
+			PrivateKeyEnv:      optionalString(m, privateKeyEnvFlag),
+			Password:           optionalString(m, privateKeyPasswordFlag),
+			PasswordFile:       optionalString(m, privateKeyPasswordFileFlag),
+			PasswordCommand:    optionalString(m, privateKeyPasswordCommandFlag),
+			BaseUrl:            required[serverBaseUrlFlag],
+			KeyID:              required[keyIDFlag],
+			SigningProfile:     optionalString(m, signingProfileFlag),
+			CoveredComponents:  optionalStrings(m, coveredComponentsFlag),
+			ExcludedComponents: optionalStrings(m, excludedComponentsFlag),
+			RequiredComponents: optionalStrings(m, requiredComponentsFlag),
+			SignatureLifetime:  lifetime,
+			ClockOffset:        offset,
+			AutoClockOffset:    autoOffset,
+			NonceLength:        nonceLength,
+			DigestAlgorithm:    optionalString(m, digestAlgorithmFlag),
+			NextKeys:           nextKeys,
+			Routes:             routes,
+
+			AgentKeyFingerprint:      optionalString(m, agentKeyFlag),
+			AgentSocket:              optionalString(m, agentSocketFlag),
+			SignerCommand:            optionalString(m, signerCommandFlag),
+			SignerSocket:             optionalString(m, signerSocketFlag),
+			SignerAlgorithm:          optionalString(m, signerAlgorithmFlag),
+			WebhookPublicKeyFileName: optionalString(m, webhookPublicKeyFlag),
 		},
 	}, nil
 }
 
+// signingKeys parses the list of additional private keys of the key config.
+func signingKeys(m map[string]interface{}, key string) ([]config.SigningKey, error) {
+	v, ok := m[key]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.Errorf("invalid %s: not a list", key)
+	}
+	res := make([]config.SigningKey, 0, len(items))
+	for i, item := range items {
+		km := stringMap(item)
+		if km == nil {
+			return nil, errors.Errorf("invalid %s: item %d is not a map", key, i+1)
+		}
+		for _, unsupported := range []string{agentKeyFlag, agentSocketFlag, signerCommandFlag, signerSocketFlag, signerAlgorithmFlag} {
+			if _, ok := km[unsupported]; ok {
+				return nil, errors.Errorf("invalid %s: item %d: %s is not supported, use %s, %s or %s",
+					key, i+1, unsupported, privateKeyFileNameFlag, privateKeyDataFlag, privateKeyEnvFlag)
+			}
+		}
+		res = append(res, config.SigningKey{
+			KeyID:              optionalString(km, keyIDFlag),
+			PrivateKeyFileName: optionalString(km, privateKeyFileNameFlag),
+			PrivateKeyData:     optionalString(km, privateKeyDataFlag),
+			PrivateKeyEnv:      optionalString(km, privateKeyEnvFlag),
+			Password:           optionalString(km, privateKeyPasswordFlag),
+			PasswordFile:       optionalString(km, privateKeyPasswordFileFlag),
+			PasswordCommand:    optionalString(km, privateKeyPasswordCommandFlag),
+		})
+	}
+	return res, nil
+}
+
+// parseRoutes parses the routing table of the key config.
+func parseRoutes(m map[string]interface{}, key string) ([]config.Route, error) {
+	v, ok := m[key]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.Errorf("invalid %s: not a list", key)
+	}
+	res := make([]config.Route, 0, len(items))
+	for i, item := range items {
+		rm := stringMap(item)
+		if rm == nil {
+			return nil, errors.Errorf("invalid %s: item %d is not a map", key, i+1)
+		}
+		timeout, err := optionalDuration(rm, routeTimeoutKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s: item %d", key, i+1)
+		}
+		res = append(res, config.Route{
+			PathPrefix:        optionalString(rm, routePathPrefixKey),
+			Host:              optionalString(rm, routeHostKey),
+			Header:            optionalString(rm, routeHeaderKey),
+			HeaderValue:       optionalString(rm, routeHeaderValueKey),
+			BaseUrl:           optionalString(rm, serverBaseUrlFlag),
+			RewritePathPrefix: optionalString(rm, routeRewritePathPrefixKey),
+			Timeout:           timeout,
+		})
+	}
+	return res, nil
+}
+
+func stringMap(v interface{}) map[string]interface{} {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(m))
+		for k, val := range m {
+			res[fmt.Sprintf("%v", k)] = val
+		}
+		return res
+	}
+	return nil
+}
+
+// optionalString returns the value of a key which may be absent in the key config.
+func optionalString(m map[string]interface{}, key string) string {
+	if v, ok := m[key]; ok && v != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return ""
+}
+
+func optionalDuration(m map[string]interface{}, key string) (time.Duration, error) {
+	v := optionalString(m, key)
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s", key)
+	}
+	return d, nil
+}
+
+func optionalInt(m map[string]interface{}, key string) (int, error) {
+	v := optionalString(m, key)
+	if v == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s", key)
+	}
+	return i, nil
+}
+
+// parseClockOffset parses a duration or the "auto" value.
+func parseClockOffset(v string) (time.Duration, bool, error) {
+	if v == "" {
+		return 0, false, nil
+	}
+	if v == config.AutoClockOffset {
+		return 0, true, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "invalid %s", clockOffsetFlag)
+	}
+	return d, false, nil
+}
+
+// optionalStrings returns the list value of a key which may be absent in the key config.
+func optionalStrings(m map[string]interface{}, key string) []string {
+	switch v := m[key].(type) {
+	case []interface{}:
+		res := make([]string, 0, len(v))
+		for _, item := range v {
+			res = append(res, fmt.Sprintf("%v", item))
+		}
+		return res
+	case string:
+		return strings.Split(v, ",")
+	}
+	return nil
+}
+
 func bindFlags(cmd *cobra.Command) {
 	cmd.Flags().VisitAll(func(f *pflag.Flag) {
 		if strings.Contains(f.Name, "-") {
@@ -0,0 +1,301 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/logger"
+	"github.com/upvestco/httpsignature-proxy/service/signer/material"
+	"github.com/upvestco/httpsignature-proxy/service/signer/request"
+)
+
+const (
+	headerFlag = "header"
+	dataFlag   = "data"
+	outputFlag = "output"
+
+	outputCurl = "curl"
+	outputRaw  = "raw"
+	outputJSON = "json"
+)
+
+var (
+	signHeaders []string
+	signData    string
+	signOutput  string
+)
+
+var signCmd = &cobra.Command{
+	Use:   "sign [METHOD URL]",
+	Short: "Signs an HTTP request without sending it and prints it as curl command, raw HTTP or JSON",
+	Long: "Signs an HTTP request with a configured key without sending it. The request is given by the method,\n" +
+		"the URL, the headers and the body, or read as a raw HTTP request from stdin. A URL without the host\n" +
+		"is resolved against the server base URL of the key config.",
+	Example: "  httpsignature-proxy sign -c <client id> GET /accounts -H 'Upvest-Client-Id: <client id>'\n" +
+		"  httpsignature-proxy sign -f key.pem -i <key id> POST https://sandbox.upvest.co/orders -d @order.json --output raw\n" +
+		"  httpsignature-proxy sign -c <client id> --output json < request.http",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 && len(args) != 2 {
+			return errors.New("expected METHOD and URL, or no arguments to read the raw request from stdin")
+		}
+		return nil
+	},
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(cmd)
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := signRequest(args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(signCmd)
+
+	addKeyFlags(signCmd.Flags())
+	signCmd.Flags().StringArrayVarP(&signHeaders, headerFlag, "H", nil, "request header 'Name: value', can be repeated")
+	signCmd.Flags().StringVarP(&signData, dataFlag, "d", "", "request body, @file reads it from the file and @- from stdin")
+	signCmd.Flags().StringVarP(&signOutput, outputFlag, "o", outputCurl, "output format: "+strings.Join([]string{outputCurl, outputRaw, outputJSON}, ", "))
+	signCmd.Flags().StringVar(&explain, explainFlag, "", "print how the signature base is built to stderr: "+strings.Join(material.ExplainFormats(), ", "))
+}
+
+func signRequest(args []string) error {
+	if signOutput != outputCurl && signOutput != outputRaw && signOutput != outputJSON {
+		return errors.Errorf("unsupported output format %q", signOutput)
+	}
+	if err := validateExplainFormat(explain); err != nil {
+		return err
+	}
+	req, body, err := readSignRequest(args, os.Stdin)
+	if err != nil {
+		return err
+	}
+	flagConfig, err := keyConfigFromFlags()
+	if err != nil {
+		return err
+	}
+	keyConfig, err := selectKeyConfig(flagConfig, req.URL)
+	if err != nil {
+		return err
+	}
+	// the sign command does not talk to the server, so the clock offset is not detected
+	keyConfig.AutoClockOffset = false
+	if !req.URL.IsAbs() {
+		base, err := url.Parse(keyConfig.BaseUrl)
+		if err != nil {
+			return errors.Wrap(err, "base url")
+		}
+		req.URL = base.ResolveReference(req.URL)
+	}
+	req.Host = req.URL.Host
+
+	signerConfigs, err := buildSignerConfigs([]config.KeyConfig{keyConfig}, 30*time.Second, nil)
+	if err != nil {
+		return err
+	}
+	sign := signerConfigs[keyConfig.ClientID].SignBuilder.GetDefaultPrivateKey()
+	if req.Header.Get("Accept") == "" {
+		// the proxy adds the same default
+		req.Header.Set("Accept", "*/*")
+	}
+	// the explanation goes to stderr, so the signed request can still be piped
+	if err := request.NewWithExplain(stderrLogger{logger.New(false)}, explain).Sign(req, sign); err != nil {
+		return err
+	}
+
+	switch signOutput {
+	case outputRaw:
+		printRawRequest(os.Stdout, req, body)
+	case outputJSON:
+		return printJSONRequest(os.Stdout, req)
+	default:
+		printCurlRequest(os.Stdout, req, body)
+	}
+	return nil
+}
+
+// readSignRequest builds the request from the arguments and flags, or reads the raw request from stdin.
+func readSignRequest(args []string, stdin io.Reader) (*http.Request, []byte, error) {
+	if len(args) == 0 {
+		raw, err := http.ReadRequest(bufio.NewReader(stdin))
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "read raw request from stdin")
+		}
+		body, err := io.ReadAll(raw.Body)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "read request body")
+		}
+		target := *raw.URL
+		if !target.IsAbs() && raw.Host != "" {
+			target.Scheme, target.Host = "https", raw.Host
+		}
+		req, err := http.NewRequest(raw.Method, target.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header = raw.Header
+		// the length is a property of the body read, the printed request gets its own
+		req.Header.Del("Content-Length")
+		return req, body, nil
+	}
+
+	var body []byte
+	var err error
+	switch {
+	case signData == "@-":
+		body, err = io.ReadAll(stdin)
+	case strings.HasPrefix(signData, "@"):
+		body, err = os.ReadFile(strings.TrimPrefix(signData, "@"))
+	default:
+		body = []byte(signData)
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "read request body")
+	}
+	req, err := http.NewRequest(strings.ToUpper(args[0]), args[1], bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, header := range signHeaders {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, nil, errors.Errorf("invalid header %q, expected 'Name: value'", header)
+		}
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return req, body, nil
+}
+
+// selectKeyConfig returns the key config of the flags, or the one of the config file selected by the client id.
+func selectKeyConfig(flagConfig config.KeyConfig, target *url.URL) (config.KeyConfig, error) {
+	if !flagConfig.BaseConfig.IsEmpty() {
+		if flagConfig.ClientID == "" {
+			flagConfig.ClientID = config.DefaultClientKey
+		}
+		if flagConfig.BaseUrl == "" && target.IsAbs() {
+			flagConfig.BaseUrl = target.Scheme + "://" + target.Host
+		}
+		return flagConfig, nil
+	}
+	switch {
+	case len(keyConfigs) == 0:
+		return config.KeyConfig{}, errors.Errorf("no key configured, use --%s and --%s or a config file", privateKeyFileNameFlag, keyIDFlag)
+	case flagConfig.ClientID != "":
+		for _, keyConfig := range keyConfigs {
+			if keyConfig.ClientID == flagConfig.ClientID {
+				return keyConfig, nil
+			}
+		}
+		return config.KeyConfig{}, errors.Errorf("no key config for clientID %s", flagConfig.ClientID)
+	case len(keyConfigs) == 1:
+		return keyConfigs[0], nil
+	}
+	for _, keyConfig := range keyConfigs {
+		if keyConfig.ClientID == config.DefaultClientKey {
+			return keyConfig, nil
+		}
+	}
+	return config.KeyConfig{}, errors.Errorf("several key configs, select one with --%s", clientIDFlag)
+}
+
+// stderrLogger prints the messages to stderr instead of stdout.
+type stderrLogger struct {
+	logger.Logger
+}
+
+func (l stderrLogger) PrintLn(message string) {
+	fmt.Fprintln(os.Stderr, message)
+}
+
+func sortedHeaderNames(header http.Header) []string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func printCurlRequest(w io.Writer, req *http.Request, body []byte) {
+	lines := []string{fmt.Sprintf("curl -X %s %s", req.Method, shellQuote(req.URL.String()))}
+	for _, name := range sortedHeaderNames(req.Header) {
+		for _, value := range req.Header[name] {
+			lines = append(lines, "  -H "+shellQuote(name+": "+value))
+		}
+	}
+	if len(body) > 0 {
+		lines = append(lines, "  --data-binary "+shellQuote(string(body)))
+	}
+	fmt.Fprintln(w, strings.Join(lines, " \\\n"))
+}
+
+// printRawRequest prints the request in the HTTP/1.1 wire format, which the verify command reads.
+func printRawRequest(w io.Writer, req *http.Request, body []byte) {
+	out := new(strings.Builder)
+	fmt.Fprintf(out, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	fmt.Fprintf(out, "Host: %s\r\n", req.Host)
+	for _, name := range sortedHeaderNames(req.Header) {
+		for _, value := range req.Header[name] {
+			fmt.Fprintf(out, "%s: %s\r\n", name, value)
+		}
+	}
+	if len(body) > 0 && req.Header.Get("Content-Length") == "" {
+		fmt.Fprintf(out, "Content-Length: %d\r\n", len(body))
+	}
+	out.WriteString("\r\n")
+	out.Write(body)
+	fmt.Fprint(w, out.String())
+}
+
+func printJSONRequest(w io.Writer, req *http.Request) error {
+	headers := make(map[string]string, len(req.Header))
+	for name, values := range req.Header {
+		headers[name] = strings.Join(values, ", ")
+	}
+	out, err := json.MarshalIndent(struct {
+		Method  string            `json:"method"`
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+	}{Method: req.Method, URL: req.URL.String(), Headers: headers}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, string(out))
+	return nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,126 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/logger"
+	"github.com/upvestco/httpsignature-proxy/service/signer"
+	"github.com/upvestco/httpsignature-proxy/service/signer/material"
+	"github.com/upvestco/httpsignature-proxy/service/signer/request"
+)
+
+const rawOrderRequest = "POST /orders HTTP/1.1\r\n" +
+	"Host: sandbox.upvest.co\r\n" +
+	"Content-Type: application/json\r\n" +
+	"Content-Length: 7\r\n" +
+	"\r\n" +
+	`{"a":1}`
+
+func TestReadSignRequest(t *testing.T) {
+	req, body, err := readSignRequest(nil, strings.NewReader(rawOrderRequest))
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "https://sandbox.upvest.co/orders", req.URL.String())
+	assert.Equal(t, `{"a":1}`, string(body))
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Empty(t, req.Header.Values("Content-Length"))
+
+	signHeaders, signData = []string{"Content-Type: application/json", "Idempotency-Key:  1 "}, `{"a":1}`
+	defer func() {
+		signHeaders, signData = nil, ""
+	}()
+	req, body, err = readSignRequest([]string{"post", "/orders"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "/orders", req.URL.String())
+	assert.Equal(t, `{"a":1}`, string(body))
+	assert.Equal(t, "1", req.Header.Get("Idempotency-Key"))
+
+	signData = "@-"
+	_, body, err = readSignRequest([]string{"POST", "/orders"}, strings.NewReader("from stdin"))
+	require.NoError(t, err)
+	assert.Equal(t, "from stdin", string(body))
+
+	signHeaders, signData = []string{"no colon"}, ""
+	_, _, err = readSignRequest([]string{"GET", "/orders"}, nil)
+	assert.ErrorContains(t, err, "invalid header")
+}
+
+func TestPrintRequest(t *testing.T) {
+	pair, err := signer.GenerateKeyPair(signer.KeyTypeEd25519, testPassword)
+	require.NoError(t, err)
+	builder, err := signer.NewLocalPrivateSchemeBuilder(&config.BaseConfig{KeyID: "key", PrivateKeyData: string(pair.PrivateKey), Password: testPassword})
+	require.NoError(t, err)
+	verifier, err := signer.NewVerifier(pair.PublicKey)
+	require.NoError(t, err)
+
+	req, body, err := readSignRequest(nil, strings.NewReader(rawOrderRequest))
+	require.NoError(t, err)
+	req.Host = req.URL.Host
+	require.NoError(t, request.New(logger.New(false)).Sign(req, builder.GetDefaultPrivateKey()))
+
+	t.Run("raw", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		printRawRequest(out, req, body)
+		assert.Equal(t, 1, strings.Count(out.String(), "Content-Length:"))
+
+		printed, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(out.Bytes())))
+		require.NoError(t, err)
+		printedBody, err := io.ReadAll(printed.Body)
+		require.NoError(t, err)
+		assert.Equal(t, body, printedBody)
+
+		reports, err := verifier.VerifyDump(bytes.NewReader(out.Bytes()))
+		require.NoError(t, err)
+		require.Len(t, reports, 1)
+		assert.True(t, reports[0].Valid(), reports[0].Problems())
+	})
+
+	t.Run("curl", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		printCurlRequest(out, req, body)
+		assert.True(t, strings.HasPrefix(out.String(), "curl -X POST 'https://sandbox.upvest.co/orders' \\\n"), out.String())
+		assert.Contains(t, out.String(), "  -H 'Signature-Input: ")
+		assert.Contains(t, out.String(), "  --data-binary '{\"a\":1}'\n")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		require.NoError(t, printJSONRequest(out, req))
+		var printed struct {
+			Method  string            `json:"method"`
+			URL     string            `json:"url"`
+			Headers map[string]string `json:"headers"`
+		}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &printed))
+		assert.Equal(t, http.MethodPost, printed.Method)
+		assert.Equal(t, "https://sandbox.upvest.co/orders", printed.URL)
+		assert.Equal(t, req.Header.Get(material.SignatureHeader), printed.Headers[material.SignatureHeader])
+	})
+}
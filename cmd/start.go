@@ -17,18 +17,27 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
-	"sync"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/upvestco/httpsignature-proxy/service/localca"
 	"github.com/upvestco/httpsignature-proxy/service/logger"
 	"github.com/upvestco/httpsignature-proxy/service/runtime"
 	"github.com/upvestco/httpsignature-proxy/service/signer"
+	"github.com/upvestco/httpsignature-proxy/service/signer/material"
+	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
 	"github.com/upvestco/httpsignature-proxy/service/tunnels"
 	"github.com/upvestco/httpsignature-proxy/service/ui"
 
@@ -38,9 +47,31 @@ import (
 const (
 	privateKeyFileNameFlag = "private-key"
 	privateKeyPasswordFlag = "private-key-password"
+	privateKeyDataFlag     = "private-key-data"
+	privateKeyEnvFlag      = "private-key-env"
+
+	privateKeyPasswordFileFlag    = "private-key-password-file"
+	privateKeyPasswordCommandFlag = "private-key-password-command"
+
 	keyIDFlag              = "key-id"
 	clientIDFlag           = "client-id"
 	serverBaseUrlFlag      = "server-base-url"
+	signingProfileFlag     = "signing-profile"
+	coveredComponentsFlag  = "covered-components"
+	excludedComponentsFlag = "excluded-components"
+	requiredComponentsFlag = "required-components"
+	signatureLifetimeFlag  = "signature-lifetime"
+	clockOffsetFlag        = "clock-offset"
+	nonceLengthFlag        = "nonce-length"
+	clockSkewThresholdFlag = "clock-skew-threshold"
+	digestAlgorithmFlag    = "digest-algorithm"
+	verifyDigestsFlag      = "verify-digests"
+	webhookPublicKeyFlag   = "webhook-public-key"
+	agentKeyFlag           = "ssh-agent-key"
+	agentSocketFlag        = "ssh-agent-socket"
+	signerCommandFlag      = "signer-command"
+	signerSocketFlag       = "signer-socket"
+	signerAlgorithmFlag    = "signer-algorithm"
 	portFlag               = "port"
 	verboseModeFlag        = "verbose-mode"
 	updateFlag             = "update"
@@ -48,13 +79,41 @@ const (
 	eventsFlag             = "events"
 	showWebhookHeader      = "show-webhook-headers"
 	uiFlag                 = "ui"
+	reloadFlag             = "reload"
+	explainFlag            = "explain"
+	tlsPortFlag            = "tls-port"
+	tlsDirFlag             = "tls-dir"
+	tlsListenAddressFlag   = "tls-listen-address"
+	forwardProxyFlag       = "forward-proxy"
+	listenAddressFlag      = "listen-address"
+	listenSocketModeFlag   = "listen-socket-mode"
 )
 
 var (
 	keyConfigs         []config.KeyConfig
 	privateKeyFileName string
 	privateKeyPassword string
+	privateKeyData     string
+	privateKeyEnv      string
+	passwordFile       string
+	passwordCommand    string
 	serverBaseUrl      string
+	signingProfile     string
+	coveredComponents  []string
+	excludedComponents []string
+	requiredComponents []string
+	signatureLifetime  time.Duration
+	clockOffset        string
+	nonceLength        int
+	clockSkewThreshold time.Duration
+	digestAlgorithm    string
+	verifyDigests      bool
+	webhookPublicKey   string
+	agentKey           string
+	agentSocket        string
+	signerCommand      string
+	signerSocket       string
+	signerAlgorithm    string
 	keyID              string
 	clientID           string
 	port               int
@@ -64,6 +123,14 @@ var (
 	logHeaders         bool
 	uiIsActive         bool
 	events             []string
+	reload             bool
+	explain            string
+	tlsPort            int
+	tlsDir             string
+	tlsListenAddress   string
+	forwardProxy       bool
+	listenAddress      string
+	listenSocketMode   string
 )
 
 var startCmd = &cobra.Command{
@@ -83,17 +150,50 @@ func init() {
 	// Register the start command
 	RootCmd.AddCommand(startCmd)
 
-	startCmd.Flags().StringVarP(&privateKeyFileName, privateKeyFileNameFlag, "f", "", "filename of the private key file")
-	startCmd.Flags().StringVarP(&privateKeyPassword, privateKeyPasswordFlag, "P", "", "password of the private key")
-	startCmd.Flags().StringVarP(&serverBaseUrl, serverBaseUrlFlag, "s", "", "server base URL to pipe the requests to")
-	startCmd.Flags().StringVarP(&keyID, keyIDFlag, "i", "", "id of the private key")
-	startCmd.Flags().StringVarP(&clientID, clientIDFlag, "c", "", "client id for the private key")
+	addKeyFlags(startCmd.Flags())
+	startCmd.Flags().BoolVar(&verifyDigests, verifyDigestsFlag, false, "verify the Content-Digest of the responses and webhook payloads")
+	startCmd.Flags().StringVar(&webhookPublicKey, webhookPublicKeyFlag, "", "filename of the Upvest public key to verify the webhook event signatures")
+	startCmd.Flags().DurationVar(&clockSkewThreshold, clockSkewThresholdFlag, config.DefaultClockSkewThreshold, "clock skew with the server above which a warning is printed")
 	startCmd.Flags().BoolVarP(&verboseMode, verboseModeFlag, "v", false, "enable verbose mode")
 	startCmd.Flags().IntVarP(&port, portFlag, "p", 3000, "port to start server")
+	startCmd.Flags().StringVar(&listenAddress, listenAddressFlag, "", "host:port or unix:/path/to.sock to listen on instead of localhost with --port, port 0 picks a free port")
+	startCmd.Flags().StringVar(&listenSocketMode, listenSocketModeFlag, "0600", "octal file permissions of the unix socket")
 	startCmd.Flags().BoolVarP(&listen, listenFlag, "l", false, "enable webhook events listening")
 	startCmd.Flags().StringSliceVarP(&events, eventsFlag, "e", []string{}, "subscribe for event types")
 	startCmd.Flags().BoolVar(&logHeaders, showWebhookHeader, false, "show webhook request headers.")
 	startCmd.Flags().BoolVar(&uiIsActive, uiFlag, false, "enable UI mode")
+	startCmd.Flags().BoolVar(&reload, reloadFlag, true, "reload the configuration when the config or key files change and on SIGHUP")
+	startCmd.Flags().IntVar(&tlsPort, tlsPortFlag, 0, "port of the HTTPS listener with a certificate of the local CA, disabled when 0")
+	startCmd.Flags().StringVar(&tlsListenAddress, tlsListenAddressFlag, "", "host:port of the HTTPS listener instead of the host of --listen-address with --tls-port, port 0 picks a free port")
+	startCmd.Flags().StringVar(&tlsDir, tlsDirFlag, "", "directory of the local CA and the localhost certificate (default "+defaultTLSDirName+" next to the config file)")
+	startCmd.Flags().BoolVar(&forwardProxy, forwardProxyFlag, false, "act as HTTP(S) forward proxy: sign the requests to the server base URLs, e.g. with HTTPS_PROXY, and tunnel the others")
+	startCmd.Flags().StringVar(&explain, explainFlag, "", "print how the signature base of every request is built: "+strings.Join(material.ExplainFormats(), ", "))
+}
+
+// addKeyFlags registers the flags of the key config given on the command line.
+func addKeyFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&privateKeyFileName, privateKeyFileNameFlag, "f", "", "filename of the private key file")
+	flags.StringVarP(&privateKeyPassword, privateKeyPasswordFlag, "P", "", "password of the private key")
+	flags.StringVar(&privateKeyData, privateKeyDataFlag, "", "PEM or base64 encoded PEM private key, used instead of the private key file")
+	flags.StringVar(&privateKeyEnv, privateKeyEnvFlag, "", "environment variable with the PEM or base64 encoded PEM private key")
+	flags.StringVar(&passwordFile, privateKeyPasswordFileFlag, "", "file with the password of the private key")
+	flags.StringVar(&passwordCommand, privateKeyPasswordCommandFlag, "", "shell command printing the password of the private key, e.g. of a password manager")
+	flags.StringVarP(&serverBaseUrl, serverBaseUrlFlag, "s", "", "server base URL to pipe the requests to")
+	flags.StringVarP(&keyID, keyIDFlag, "i", "", "id of the private key")
+	flags.StringVarP(&clientID, clientIDFlag, "c", "", "client id for the private key")
+	flags.StringVar(&signingProfile, signingProfileFlag, "", "signing profile of the private key: "+strings.Join(material.ProfileNames(), ", ")+" (default "+material.DefaultProfileName+")")
+	flags.StringSliceVar(&coveredComponents, coveredComponentsFlag, nil, "allow-list of the covered components, e.g. @method,@target-uri,content-type")
+	flags.StringSliceVar(&excludedComponents, excludedComponentsFlag, nil, "deny-list of the components, a trailing * matches by prefix (default "+strings.Join(material.DefaultExcludedComponents, ",")+")")
+	flags.StringSliceVar(&requiredComponents, requiredComponentsFlag, nil, "components which must be present in every request")
+	flags.DurationVar(&signatureLifetime, signatureLifetimeFlag, material.DefaultLifetime, "validity of the signatures")
+	flags.StringVar(&clockOffset, clockOffsetFlag, "", "offset added to the local clock for the signatures, e.g. -3s, or 'auto' to detect it from the server")
+	flags.IntVar(&nonceLength, nonceLengthFlag, material.DefaultNonceLength, "number of digits in the signature nonce")
+	flags.StringVar(&digestAlgorithm, digestAlgorithmFlag, "", "Content-Digest algorithm: "+strings.Join(material.DigestAlgorithms(), ", ")+" (default "+material.DefaultDigestAlgorithm+")")
+	flags.StringVar(&agentKey, agentKeyFlag, "", "fingerprint of the ssh-agent key used instead of the private key file")
+	flags.StringVar(&agentSocket, agentSocketFlag, "", "ssh-agent socket (default $SSH_AUTH_SOCK)")
+	flags.StringVar(&signerCommand, signerCommandFlag, "", "shell command which signs the signature base, used instead of the private key file")
+	flags.StringVar(&signerSocket, signerSocketFlag, "", "unix socket of the external signer, used instead of the private key file")
+	flags.StringVar(&signerAlgorithm, signerAlgorithmFlag, "", "algorithm of the external signer: "+schema.AlgoEd25519+" or "+schema.AlgoECDSA)
 }
 
 func startProxy() {
@@ -109,84 +209,118 @@ func startProxy() {
 }
 
 func startWithUI(cfg *config.Config, signerConfigs map[string]runtime.SignerConfig) {
-	var tnls *tunnels.Tunnels
-	var userCredentialsCh chan tunnels.UserCredentials
-	wg := sync.WaitGroup{}
-	wg.Add(1)
 	ll := ui.CreateLogger(cfg.VerboseMode)
-
+	closed := make(chan struct{})
 	ui.Create(func() {
-		ui.Close()
-		wg.Done()
+		close(closed)
 	})
-	if listen {
-		userCredentialsCh = make(chan tunnels.UserCredentials)
-		proxyAddress := fmt.Sprintf("http://localhost:%d", port)
-		tnls = tunnels.CreateTunnels(ll, events, proxyAddress,
-			func(credentials tunnels.UserCredentials) tunnels.ApiClient {
-				return tunnels.NewClient(proxyAddress, credentials, cfg.DefaultTimeout)
-			}, logHeaders)
-	}
-
-	proxy := runtime.NewProxy(cfg, signerConfigs, userCredentialsCh, ll)
-	if err := proxy.Run(); err == nil {
-		ll.PrintF("Starting to listen on port %d\n", port)
-	} else {
-		panic("Fail to start http proxy: " + err.Error())
-	}
-	if tnls != nil {
-		go tnls.Start(userCredentialsCh)
-	}
-	wg.Wait()
-	if tnls != nil {
-		close(userCredentialsCh)
-		tnls.Stop()
+	err := serve(cfg, signerConfigs, ll, closed)
+	ui.Close()
+	if err != nil {
+		log.Fatal(err)
 	}
 }
 
 func startDefault(cfg *config.Config, signerConfigs map[string]runtime.SignerConfig) {
 	ll := logger.New(cfg.VerboseMode)
+	if err := serve(cfg, signerConfigs, ll, nil); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serve runs the proxy and the webhook tunnels until SIGINT or SIGTERM, until closed is closed or
+// the proxy fails. The tunnels delete their webhooks through the proxy, so they stop first.
+func serve(cfg *config.Config, signerConfigs map[string]runtime.SignerConfig, ll logger.Logger, closed <-chan struct{}) error {
 	var userCredentialsCh chan tunnels.UserCredentials
-	var tnls *tunnels.Tunnels
 	if listen {
 		userCredentialsCh = make(chan tunnels.UserCredentials)
-		proxyAddress := fmt.Sprintf("http://localhost:%d", port)
-		tnls = tunnels.CreateTunnels(ll, events, proxyAddress,
-			func(credentials tunnels.UserCredentials) tunnels.ApiClient {
-				return tunnels.NewClient(proxyAddress, credentials, cfg.DefaultTimeout)
-			}, logHeaders)
 	}
-
 	proxy := runtime.NewProxy(cfg, signerConfigs, userCredentialsCh, ll)
-	if err := proxy.Run(); err == nil {
-		ll.PrintF("Starting to listen on port %d\n", port)
-	} else {
-		panic("Fail to start http proxy: " + err.Error())
+	if err := proxy.Run(); err != nil {
+		return errors.Wrap(err, "Fail to start http proxy")
 	}
-	if tnls != nil {
+	ll.PrintF("Starting to listen on %s\n", proxy.ClientAddress())
+	printTLSListener(cfg, &proxy, ll)
+
+	var tnls *tunnels.Tunnels
+	if listen {
+		tnls = createTunnels(cfg, proxy.ClientAddress(), signerConfigs, ll)
 		go tnls.Start(userCredentialsCh)
 	}
+	if reload {
+		startReloading(cfg, &proxy, tnls, signerConfigs, ll)
+	}
 	ll.PrintLn("Press CTRL-C to exit")
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT)
-	<-c
+	defer signal.Stop(c)
+	select {
+	case <-c:
+	case <-closed:
+	case <-proxy.Done():
+		return proxy.Err()
+	}
+
 	if tnls != nil {
-		close(userCredentialsCh)
 		tnls.Stop()
 	}
+	ll.PrintLn("Stopping the proxy")
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DefaultTimeout)
+	defer cancel()
+	return proxy.Shutdown(ctx)
 }
 
-func initializeSignerConfig() (*config.Config, map[string]runtime.SignerConfig) {
-	flagConfig := config.KeyConfig{
+// createTunnels creates the webhook tunnels which call the API through the proxy at the address.
+func createTunnels(cfg *config.Config, proxyAddress string, signerConfigs map[string]runtime.SignerConfig, ll logger.Logger) *tunnels.Tunnels {
+	return tunnels.CreateTunnels(ll, events, proxyAddress,
+		func(credentials tunnels.UserCredentials) tunnels.ApiClient {
+			return tunnels.NewClient(proxyAddress, credentials, cfg.DefaultTimeout)
+		}, logHeaders, verifyDigests, webhookVerifiers(signerConfigs))
+}
+
+// keyConfigFromFlags returns the key config given by the command line flags.
+func keyConfigFromFlags() (config.KeyConfig, error) {
+	offset, autoOffset, err := parseClockOffset(clockOffset)
+	if err != nil {
+		return config.KeyConfig{}, err
+	}
+	return config.KeyConfig{
 		ClientID: clientID,
 		BaseConfig: config.BaseConfig{
 			BaseUrl:            serverBaseUrl,
 			KeyID:              keyID,
 			PrivateKeyFileName: privateKeyFileName,
+			PrivateKeyData:     privateKeyData,
+			PrivateKeyEnv:      privateKeyEnv,
 			Password:           privateKeyPassword,
+			PasswordFile:       passwordFile,
+			PasswordCommand:    passwordCommand,
+			SigningProfile:     signingProfile,
+			CoveredComponents:  coveredComponents,
+			ExcludedComponents: excludedComponents,
+			RequiredComponents: requiredComponents,
+			SignatureLifetime:  signatureLifetime,
+			ClockOffset:        offset,
+			AutoClockOffset:    autoOffset,
+			NonceLength:        nonceLength,
+			DigestAlgorithm:    digestAlgorithm,
+
+			AgentKeyFingerprint:      agentKey,
+			AgentSocket:              agentSocket,
+			SignerCommand:            signerCommand,
+			SignerSocket:             signerSocket,
+			SignerAlgorithm:          signerAlgorithm,
+			WebhookPublicKeyFileName: webhookPublicKey,
 		},
-	}
+	}, nil
+}
 
+func initializeSignerConfig() (*config.Config, map[string]runtime.SignerConfig) {
+	flagConfig, err := keyConfigFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
 	if !flagConfig.IsEmpty() {
 		if err := flagConfig.BaseConfig.Validate(); err != nil {
 			fatalConfigError(flagConfig, err)
@@ -194,7 +328,8 @@ func initializeSignerConfig() (*config.Config, map[string]runtime.SignerConfig)
 		if flagConfig.ClientID == "" {
 			flagConfig.ClientID = config.DefaultClientKey
 		}
-		keyConfigs = append(keyConfigs, flagConfig)
+		flagKeyConfig = flagConfig
+		keyConfigs = append(keyConfigs, cloneKeyConfig(flagConfig))
 	}
 
 	cfg := &config.Config{
@@ -204,39 +339,192 @@ func initializeSignerConfig() (*config.Config, map[string]runtime.SignerConfig)
 		VerboseMode:    verboseMode,
 		KeyConfigs:     keyConfigs,
 		LogHeaders:     logHeaders,
+
+		ClockSkewThreshold: clockSkewThreshold,
+		VerifyDigests:      verifyDigests,
+		Explain:            explain,
+	}
+	if err := validateExplainFormat(explain); err != nil {
+		log.Fatal(err)
+	}
+	socketMode, err := strconv.ParseUint(listenSocketMode, 8, 32)
+	if err != nil || socketMode > 0o777 {
+		log.Fatalf("invalid --%s %s: not an octal file mode", listenSocketModeFlag, listenSocketMode)
+	}
+	cfg.ListenAddress, cfg.SocketMode = listenAddress, os.FileMode(socketMode)
+	if tlsPort != 0 || tlsListenAddress != "" || forwardProxy {
+		cfg.TLSPort, cfg.TLSListenAddress, cfg.ForwardProxy = tlsPort, tlsListenAddress, forwardProxy
+		if cfg.TLSDir = tlsDir; cfg.TLSDir == "" {
+			if cfg.TLSDir, err = defaultTLSDir(); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	signerConfigs, err := buildSignerConfigs(cfg.KeyConfigs, cfg.DefaultTimeout, nil)
+	if err != nil {
+		var keyErr *keyConfigError
+		if errors.As(err, &keyErr) {
+			fatalConfigError(keyErr.keyConfig, keyErr.err)
+		}
+		fmt.Println(err.Error())
+		log.Fatalf("Stopped due missconfiguration")
+	}
+
+	fmt.Println("Private keys initialised:")
+	for i := range keyConfigs {
+		fmt.Printf("  Key %d for clientID %s:\n", i+1, keyConfigs[i].ClientID)
+		switch {
+		case keyConfigs[i].AgentKeyFingerprint != "":
+			fmt.Printf("  - Using ssh-agent key %s for HTTP Signatures\n", keyConfigs[i].AgentKeyFingerprint)
+		case keyConfigs[i].SignerCommand != "":
+			fmt.Printf("  - Using signer command %s for HTTP Signatures\n", keyConfigs[i].SignerCommand)
+		case keyConfigs[i].SignerSocket != "":
+			fmt.Printf("  - Using signer socket %s for HTTP Signatures\n", keyConfigs[i].SignerSocket)
+		case keyConfigs[i].PrivateKeyData != "":
+			fmt.Println("  - Using inline private key data for HTTP Signatures")
+		case keyConfigs[i].PrivateKeyEnv != "":
+			fmt.Printf("  - Using private key from environment variable %s for HTTP Signatures\n", keyConfigs[i].PrivateKeyEnv)
+		default:
+			fmt.Printf("  - Using private key file %s for HTTP Signatures\n", keyConfigs[i].PrivateKeyFileName)
+		}
+		fmt.Printf("  - Using keyID %s for HTTP Signatures\n", keyConfigs[i].KeyID)
+		for j, next := range keyConfigs[i].NextKeys {
+			fmt.Printf("  - Also signing as sig%d with keyID %s from %s\n", j+2, next.KeyID,
+				privateKeyName(next.KeyID, next.PrivateKeyFileName, next.PrivateKeyData, next.PrivateKeyEnv))
+		}
+		if keyConfigs[i].SigningProfile != "" {
+			fmt.Printf("  - Using signing profile %s\n", keyConfigs[i].SigningProfile)
+		}
+		if len(keyConfigs[i].CoveredComponents) > 0 {
+			fmt.Printf("  - Covering components %s\n", strings.Join(keyConfigs[i].CoveredComponents, ", "))
+		}
+		if len(keyConfigs[i].ExcludedComponents) > 0 {
+			fmt.Printf("  - Excluding components %s\n", strings.Join(keyConfigs[i].ExcludedComponents, ", "))
+		}
+		if keyConfigs[i].DigestAlgorithm != "" {
+			fmt.Printf("  - Using Content-Digest algorithm %s\n", keyConfigs[i].DigestAlgorithm)
+		}
+		if keyConfigs[i].ClockOffset != 0 {
+			fmt.Printf("  - Using clock offset %s\n", keyConfigs[i].ClockOffset)
+		}
+		if len(keyConfigs[i].RequiredComponents) > 0 {
+			fmt.Printf("  - Requiring components %s\n", strings.Join(keyConfigs[i].RequiredComponents, ", "))
+		}
+		if keyConfigs[i].WebhookPublicKeyFileName != "" {
+			fmt.Printf("  - Verifying webhook events with public key file %s\n", keyConfigs[i].WebhookPublicKeyFileName)
+		}
+		for _, route := range keyConfigs[i].Routes {
+			fmt.Printf("  - Routing requests with %s to %s\n", route.String(), route.BaseUrl)
+		}
+		if len(keyConfigs[i].Routes) > 0 {
+			fmt.Printf("  - Piping the other requests to %s\n", keyConfigs[i].BaseUrl)
+		} else {
+			fmt.Printf("  - Piping all requests to %s\n", keyConfigs[i].BaseUrl)
+		}
 	}
 
+	return cfg, signerConfigs
+}
+
+// keyConfigError reports the key config which failed to build.
+type keyConfigError struct {
+	keyConfig config.KeyConfig
+	err       error
+}
+
+func (e *keyConfigError) Error() string {
+	return fmt.Sprintf("clientID %s: %s", e.keyConfig.ClientID, e.err.Error())
+}
+
+// buildSignerConfigs builds the signers of the key configs. On startup previous is nil and the
+// passwords of encrypted keys are prompted for, a reload reuses the passwords of the previous
+// signers instead.
+func buildSignerConfigs(keyConfigs []config.KeyConfig, timeout time.Duration, previous map[string]runtime.SignerConfig) (map[string]runtime.SignerConfig, error) {
 	signerConfigs := make(map[string]runtime.SignerConfig)
-	for i := range cfg.KeyConfigs {
-		if err := cfg.KeyConfigs[i].Validate(); err != nil {
-			fatalConfigError(cfg.KeyConfigs[i], err)
+	for i := range keyConfigs {
+		keyConfig := &keyConfigs[i]
+		if err := keyConfig.Validate(); err != nil {
+			return nil, &keyConfigError{keyConfig: *keyConfig, err: err}
 		}
-		builder, err := signer.NewLocalPrivateSchemeBuilder(&cfg.KeyConfigs[i].BaseConfig)
+		if keyConfig.AutoClockOffset {
+			detectClockOffset(&keyConfig.BaseConfig, timeout)
+		}
+		if prev, ok := previous[keyConfig.ClientID]; ok {
+			reusePasswords(&keyConfig.BaseConfig, &prev.KeyConfig)
+		}
+		if err := resolvePasswords(&keyConfig.BaseConfig, previous == nil); err != nil {
+			return nil, &keyConfigError{keyConfig: *keyConfig, err: err}
+		}
+		builder, err := newSchemeBuilder(&keyConfig.BaseConfig)
 		if err != nil {
-			log.Fatal(err)
+			return nil, &keyConfigError{keyConfig: *keyConfig, err: err}
 		}
 
-		clientID := cfg.KeyConfigs[i].ClientID
-		if _, ok := signerConfigs[clientID]; ok {
-			fmt.Printf("ClientID duplicated in configuration\n")
-			log.Fatalf("Stopped due missconfiguration")
+		if _, ok := signerConfigs[keyConfig.ClientID]; ok {
+			return nil, errors.New("ClientID duplicated in configuration")
+		}
+
+		webhookVerifier, err := newWebhookVerifier(&keyConfig.BaseConfig)
+		if err != nil {
+			return nil, &keyConfigError{keyConfig: *keyConfig, err: err}
 		}
 
-		signerConfigs[clientID] = runtime.SignerConfig{
-			SignBuilder: builder,
-			KeyConfig:   cfg.KeyConfigs[i].BaseConfig,
+		signerConfigs[keyConfig.ClientID] = runtime.SignerConfig{
+			SignBuilder:     builder,
+			KeyConfig:       keyConfig.BaseConfig,
+			WebhookVerifier: webhookVerifier,
 		}
 	}
+	return signerConfigs, nil
+}
 
-	fmt.Println("Private keys initialised:")
-	for i := range keyConfigs {
-		fmt.Printf("  Key %d for clientID %s:\n", i+1, keyConfigs[i].ClientID)
-		fmt.Printf("  - Using private key file %s for HTTP Signatures\n", keyConfigs[i].PrivateKeyFileName)
-		fmt.Printf("  - Using keyID %s for HTTP Signatures\n", keyConfigs[i].KeyID)
-		fmt.Printf("  - Piping all requests to %s\n", keyConfigs[i].BaseUrl)
+// newSchemeBuilder signs with the configured ssh-agent key or external signer and with the private key file otherwise.
+func newSchemeBuilder(cfg *config.BaseConfig) (schema.SigningSchemeBuilder, error) {
+	switch {
+	case cfg.AgentKeyFingerprint != "":
+		return signer.NewAgentSchemeBuilder(cfg)
+	case cfg.SignerCommand != "" || cfg.SignerSocket != "":
+		return signer.NewExternalSchemeBuilder(cfg)
 	}
+	return signer.NewLocalPrivateSchemeBuilder(cfg)
+}
 
-	return cfg, signerConfigs
+// newWebhookVerifier loads the Upvest public key of the key config, the verifier is nil without the key.
+func newWebhookVerifier(cfg *config.BaseConfig) (*schema.Verifier, error) {
+	if cfg.WebhookPublicKeyFileName == "" {
+		return nil, nil
+	}
+	verifier, err := signer.NewVerifierFromFile(cfg.WebhookPublicKeyFileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "webhook public key")
+	}
+	if verifier.Options, err = signer.NewMaterialOptions(&config.BaseConfig{SigningProfile: cfg.SigningProfile}); err != nil {
+		return nil, err
+	}
+	return verifier, nil
+}
+
+// webhookVerifiers returns the webhook signature verifiers by clientID.
+func webhookVerifiers(signerConfigs map[string]runtime.SignerConfig) map[string]*schema.Verifier {
+	res := make(map[string]*schema.Verifier)
+	for clientID, signerCfg := range signerConfigs {
+		if signerCfg.WebhookVerifier != nil {
+			res[clientID] = signerCfg.WebhookVerifier
+		}
+	}
+	return res
+}
+
+func detectClockOffset(cfg *config.BaseConfig, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	offset, err := signer.DetectClockOffset(ctx, http.DefaultClient, cfg.BaseUrl)
+	if err != nil {
+		fmt.Printf("Warning: failed to detect clock offset for %s: %s\n", cfg.BaseUrl, err.Error())
+		return
+	}
+	cfg.ClockOffset = offset
 }
 
 func fatalConfigError(keyConfig config.KeyConfig, err error) {
@@ -245,3 +533,25 @@ func fatalConfigError(keyConfig config.KeyConfig, err error) {
 	fmt.Printf("Error: %s\n", err.Error())
 	log.Fatalf("invalid configuration: %s\n", err.Error())
 }
+
+func validateExplainFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+	for _, f := range material.ExplainFormats() {
+		if f == format {
+			return nil
+		}
+	}
+	return errors.WithMessagef(material.ErrUnsupportedExplainFormat, "--%s %s", explainFlag, format)
+}
+
+// printTLSListener tells how the clients reach the HTTPS listener or the forward proxy and which CA they have to trust.
+func printTLSListener(cfg *config.Config, proxy *runtime.Proxy, ll logger.Logger) {
+	if addr := proxy.TLSAddr(); addr != nil {
+		ll.PrintF("Starting to listen with TLS on https://%s, trust the CA %s\n", addr, filepath.Join(cfg.TLSDir, localca.CACertFile))
+	}
+	if cfg.ForwardProxy {
+		ll.PrintF("Forward proxy mode: use HTTPS_PROXY=%s and trust the CA %s\n", proxy.ClientAddress(), filepath.Join(cfg.TLSDir, localca.CACertFile))
+	}
+}
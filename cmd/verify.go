@@ -0,0 +1,140 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/signer"
+	"github.com/upvestco/httpsignature-proxy/service/signer/material"
+	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
+)
+
+const (
+	publicKeyFlag     = "public-key"
+	signatureBaseFlag = "signature-base"
+)
+
+var (
+	publicKeyFileName     string
+	signatureBaseFileName string
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verifies the HTTP signatures of a raw HTTP request read from stdin",
+	Example: "  httpsignature-proxy verify --public-key pub.pem < request.http\n" +
+		"  httpsignature-proxy verify --public-key pub.pem --signature-base base.txt < request.http",
+	Run: func(cmd *cobra.Command, args []string) {
+		if !verifyRequest() {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().StringVarP(&publicKeyFileName, publicKeyFlag, "k", "", "filename of the public key file")
+	verifyCmd.Flags().StringVar(&signingProfile, signingProfileFlag, "", "signing profile used by the client: "+strings.Join(material.ProfileNames(), ", ")+" (default "+material.DefaultProfileName+")")
+	verifyCmd.Flags().StringVarP(&keyID, keyIDFlag, "i", "", "verify only the signatures with this keyid, e.g. when the request is signed by several keys")
+	verifyCmd.Flags().StringVarP(&signatureBaseFileName, signatureBaseFlag, "b", "", "filename of the signature base produced by the client, to find mismatched components")
+	_ = verifyCmd.MarkFlagRequired(publicKeyFlag)
+}
+
+func verifyRequest() bool {
+	verifier, err := signer.NewVerifierFromFile(publicKeyFileName)
+	if err != nil {
+		fmt.Printf("Error: failed to load public key: %s\n", err.Error())
+		return false
+	}
+	if verifier.Options, err = signer.NewMaterialOptions(&config.BaseConfig{SigningProfile: signingProfile}); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return false
+	}
+	var expectedBase []byte
+	if signatureBaseFileName != "" {
+		if expectedBase, err = os.ReadFile(signatureBaseFileName); err != nil {
+			fmt.Printf("Error: failed to read signature base: %s\n", err.Error())
+			return false
+		}
+	}
+	reports, err := verifier.VerifyDump(os.Stdin)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return false
+	}
+	valid := true
+	verified := 0
+	for _, report := range reports {
+		if keyID != "" && report.KeyID != keyID {
+			continue
+		}
+		verified++
+		printReport(report, expectedBase)
+		valid = valid && report.Valid()
+	}
+	if verified == 0 {
+		fmt.Printf("Error: no signature with keyid %q\n", keyID)
+		return false
+	}
+	return valid
+}
+
+func printReport(report *schema.VerificationReport, expectedBase []byte) {
+	status := "VALID"
+	if !report.Valid() {
+		status = "INVALID"
+	}
+	fmt.Printf("Signature %s (keyid %q): %s\n", report.Label, report.KeyID, status)
+	if report.SignatureError != nil {
+		fmt.Printf("  - signature: %s\n", report.SignatureError.Error())
+	} else {
+		fmt.Println("  - signature: matches")
+	}
+	fmt.Printf("  - components: %s\n", strings.Join(report.Components, ", "))
+	if len(report.MissingComponent) > 0 {
+		fmt.Printf("  - missing components: %s\n", strings.Join(report.MissingComponent, ", "))
+	}
+	if expectedBase != nil {
+		if mismatched := report.MismatchedComponents(expectedBase); len(mismatched) > 0 {
+			fmt.Printf("  - mismatched components: %s\n", strings.Join(mismatched, ", "))
+		}
+	}
+	created := report.Created.Format(time.RFC3339)
+	if report.NotYetValid {
+		created += " (in the future)"
+	}
+	fmt.Printf("  - created: %s\n", created)
+	expires := report.Expires.Format(time.RFC3339)
+	if report.Expired {
+		expires += " (expired)"
+	}
+	fmt.Printf("  - expires: %s\n", expires)
+	if report.DigestMismatch() {
+		fmt.Printf("  - content-digest: mismatch, received '%s', expected '%s'\n", report.ReceivedDigest, report.ExpectedDigest)
+	} else if report.ReceivedDigest != "" {
+		fmt.Println("  - content-digest: matches")
+	}
+	fmt.Printf("  - signature base:\n%s\n", report.SignatureBase)
+}
@@ -20,14 +20,23 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+
+	"github.com/upvestco/httpsignature-proxy/service/signer/material"
+	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
 )
 
 const (
 	DefaultClientKey = "default"
+	AutoClockOffset  = "auto"
+
+	DefaultClockSkewThreshold = 30 * time.Second
+
+	maxNonceLength = 64
 )
 
 type Config struct {
@@ -38,13 +47,102 @@ type Config struct {
 	VerboseMode    bool
 	LogHeaders     bool
 	Port           int
+	// ListenAddress is the host:port or unix:/path of the listener, localhost with the Port when empty.
+	// The port 0 selects a free port.
+	ListenAddress string
+	// SocketMode is the file mode of the unix socket, 0600 when 0.
+	SocketMode os.FileMode
+	// ClockSkewThreshold is the clock skew with the server above which the proxy warns.
+	ClockSkewThreshold time.Duration
+	// VerifyDigests enables the Content-Digest check of the upstream responses and webhook payloads.
+	VerifyDigests bool
+	// Explain prints how the signature base of every signed request was built, in the format
+	// "json" or "table". It is disabled when empty.
+	Explain string
+	// TLSPort is the port of the HTTPS listener on the host of the ListenAddress, it is disabled
+	// when 0 and no TLSListenAddress is set.
+	TLSPort int
+	// TLSListenAddress is the host:port of the HTTPS listener instead of the TLSPort, the port 0
+	// selects a free port.
+	TLSListenAddress string
+	// TLSDir is the directory of the local CA and the localhost certificate of the HTTPS listener.
+	TLSDir string
+	// ForwardProxy enables the HTTP(S) forward proxy mode: the CONNECT requests to the hosts of the
+	// key configs are intercepted with a certificate of the local CA and signed, the others are tunneled.
+	ForwardProxy bool
 }
 
 type BaseConfig struct {
 	BaseUrl            string
 	KeyID              string
 	PrivateKeyFileName string
+	// PrivateKeyData is the PEM or base64 encoded PEM private key used instead of the file.
+	PrivateKeyData string
+	// PrivateKeyEnv is the environment variable with the PrivateKeyData.
+	PrivateKeyEnv string
+	Password      string
+	// PasswordFile and PasswordCommand provide the password without keeping it in the configuration.
+	PasswordFile    string
+	PasswordCommand string
+	// PasswordPrompted is set when the Password was entered on the prompt, only such a password
+	// is reused on a reload.
+	PasswordPrompted   bool
+	SigningProfile     string
+	CoveredComponents  []string
+	ExcludedComponents []string
+	RequiredComponents []string
+	SignatureLifetime  time.Duration
+	ClockOffset        time.Duration
+	AutoClockOffset    bool
+	NonceLength        int
+	DigestAlgorithm    string
+	// AgentKeyFingerprint selects the ssh-agent key used instead of the private key file.
+	AgentKeyFingerprint string
+	// AgentSocket is the ssh-agent socket, SSH_AUTH_SOCK when it is empty.
+	AgentSocket string
+	// SignerCommand and SignerSocket select the external signer used instead of the private key file.
+	SignerCommand string
+	SignerSocket  string
+	// SignerAlgorithm is the algorithm of the external signer, Ed25519 or ECDSA, a response with
+	// another algorithm is rejected.
+	SignerAlgorithm string
+	// WebhookPublicKeyFileName is the Upvest public key of the environment used to verify the webhook events.
+	WebhookPublicKeyFileName string
+	// NextKeys sign every request in addition to the private key, e.g. during a key rotation.
+	NextKeys []SigningKey
+	// Routes send the matching requests to other upstreams than the BaseUrl, the first match wins.
+	Routes []Route
+}
+
+// Route selects the upstream of the requests which match all of its conditions.
+type Route struct {
+	// PathPrefix matches the request path, e.g. /auth.
+	PathPrefix string
+	// Host matches the Host header of the request, with the port only when it has one.
+	Host string
+	// Header and HeaderValue match a request header, e.g. X-Proxy-Target: staging, any value when
+	// HeaderValue is empty. The header is not sent upstream.
+	Header      string
+	HeaderValue string
+	BaseUrl     string
+	// RewritePathPrefix replaces the PathPrefix of the request path.
+	RewritePathPrefix string
+	// Timeout of the requests, the default timeout when 0.
+	Timeout time.Duration
+}
+
+// SigningKey is a private key used in addition to the main private key of a key config. It is
+// read from the file, the data or the environment variable, the ssh-agent and the external signers
+// are not supported.
+type SigningKey struct {
+	KeyID              string
+	PrivateKeyFileName string
+	PrivateKeyData     string
+	PrivateKeyEnv      string
 	Password           string
+	PasswordFile       string
+	PasswordCommand    string
+	PasswordPrompted   bool
 }
 
 type KeyConfig struct {
@@ -54,22 +152,180 @@ type KeyConfig struct {
 
 func (c *BaseConfig) IsEmpty() bool {
 	return c.BaseUrl == "" &&
-		c.KeyID == "" && c.Password == "" && c.PrivateKeyFileName == ""
+		c.KeyID == "" && c.Password == "" && c.PrivateKeyFileName == "" &&
+		c.PrivateKeyData == "" && c.PrivateKeyEnv == "" && c.AgentKeyFingerprint == "" && c.SignerCommand == "" && c.SignerSocket == ""
 }
 
 func (c *BaseConfig) Validate() error {
 	if c.KeyID == "" {
 		return errors.New("keyID is empty")
 	}
-	if _, err := os.Stat(c.PrivateKeyFileName); errors.Is(err, os.ErrNotExist) {
-		return fmt.Errorf("private key file not exists: %s", c.PrivateKeyFileName)
+	if err := validatePasswordSources(c.Password, c.PasswordFile, c.PasswordCommand); err != nil {
+		return err
+	}
+	if c.keySources() > 1 {
+		return errors.New("only one of private key file, private key data, private key env, ssh-agent key, signer command and signer socket can be used")
+	}
+	if err := c.validateSignerAlgorithm(); err != nil {
+		return err
+	}
+	switch {
+	case !c.UsesLocalPrivateKey(), c.PrivateKeyData != "":
+	case c.PrivateKeyEnv != "":
+		if os.Getenv(c.PrivateKeyEnv) == "" {
+			return fmt.Errorf("private key environment variable is empty: %s", c.PrivateKeyEnv)
+		}
+	default:
+		if _, err := os.Stat(c.PrivateKeyFileName); errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("private key file not exists: %s", c.PrivateKeyFileName)
+		}
 	}
 	if _, err := url.Parse(c.BaseUrl); err != nil || c.BaseUrl == "" {
 		return errors.New("base url is empty or invalid")
 	}
+	if len(c.CoveredComponents) > 0 && len(c.ExcludedComponents) > 0 {
+		return errors.New("covered components and excluded components can not be used together")
+	}
+	if c.SignatureLifetime < 0 {
+		return errors.New("signature lifetime is negative")
+	}
+	if c.NonceLength < 0 || c.NonceLength > maxNonceLength {
+		return fmt.Errorf("nonce length should be between 0 (default) and %d", maxNonceLength)
+	}
+	if _, err := material.NewDigest(c.DigestAlgorithm); err != nil {
+		return err
+	}
+	if c.WebhookPublicKeyFileName != "" {
+		if _, err := os.Stat(c.WebhookPublicKeyFileName); errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("webhook public key file not exists: %s", c.WebhookPublicKeyFileName)
+		}
+	}
+	for i := range c.Routes {
+		if err := c.Routes[i].Validate(); err != nil {
+			return errors.Wrapf(err, "route %d", i+1)
+		}
+	}
+	keyIDs := map[string]struct{}{c.KeyID: {}}
+	for _, key := range c.NextKeys {
+		if err := key.Validate(); err != nil {
+			return errors.Wrap(err, "next key")
+		}
+		if _, ok := keyIDs[key.KeyID]; ok {
+			return fmt.Errorf("keyID %s is used more than once", key.KeyID)
+		}
+		keyIDs[key.KeyID] = struct{}{}
+	}
+	return nil
+}
+
+func (k *SigningKey) Validate() error {
+	if k.KeyID == "" {
+		return errors.New("keyID is empty")
+	}
+	if err := validatePasswordSources(k.Password, k.PasswordFile, k.PasswordCommand); err != nil {
+		return err
+	}
+	if countSet(k.PrivateKeyFileName, k.PrivateKeyData, k.PrivateKeyEnv) > 1 {
+		return errors.New("only one of private key file, private key data and private key env can be used")
+	}
+	switch {
+	case k.PrivateKeyData != "":
+	case k.PrivateKeyEnv != "":
+		if os.Getenv(k.PrivateKeyEnv) == "" {
+			return fmt.Errorf("private key environment variable is empty: %s", k.PrivateKeyEnv)
+		}
+	default:
+		if _, err := os.Stat(k.PrivateKeyFileName); errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("private key file not exists: %s", k.PrivateKeyFileName)
+		}
+	}
 	return nil
 }
 
+func (r *Route) Validate() error {
+	if r.PathPrefix == "" && r.Host == "" && r.Header == "" {
+		return errors.New("no path prefix, host or header to match")
+	}
+	if r.PathPrefix != "" && !strings.HasPrefix(r.PathPrefix, "/") {
+		return errors.New("path prefix does not start with /")
+	}
+	if r.HeaderValue != "" && r.Header == "" {
+		return errors.New("header value without header")
+	}
+	if r.RewritePathPrefix != "" && r.PathPrefix == "" {
+		return errors.New("rewrite path prefix without path prefix")
+	}
+	if u, err := url.Parse(r.BaseUrl); err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.New("base url is empty or invalid")
+	}
+	if r.Timeout < 0 {
+		return errors.New("timeout is negative")
+	}
+	return nil
+}
+
+// String describes the conditions of the route.
+func (r *Route) String() string {
+	conditions := make([]string, 0, 3)
+	if r.PathPrefix != "" {
+		conditions = append(conditions, "path "+r.PathPrefix+"*")
+	}
+	if r.Host != "" {
+		conditions = append(conditions, "host "+r.Host)
+	}
+	if r.Header != "" {
+		value := r.HeaderValue
+		if value == "" {
+			value = "*"
+		}
+		conditions = append(conditions, "header "+r.Header+": "+value)
+	}
+	return strings.Join(conditions, ", ")
+}
+
+func validatePasswordSources(sources ...string) error {
+	if countSet(sources...) > 1 {
+		return errors.New("only one of password, password file and password command can be used")
+	}
+	return nil
+}
+
+// UsesLocalPrivateKey reports that the requests are signed with the private key from the file,
+// the data or the environment, not with the ssh-agent or an external signer.
+func (c *BaseConfig) UsesLocalPrivateKey() bool {
+	return c.AgentKeyFingerprint == "" && c.SignerCommand == "" && c.SignerSocket == ""
+}
+
+func (c *BaseConfig) keySources() int {
+	return countSet(c.PrivateKeyFileName, c.PrivateKeyData, c.PrivateKeyEnv, c.AgentKeyFingerprint, c.SignerCommand, c.SignerSocket)
+}
+
+// countSet returns the number of the non-empty sources.
+// validateSignerAlgorithm checks that the external signer has a supported algorithm.
+func (c *BaseConfig) validateSignerAlgorithm() error {
+	if c.SignerCommand == "" && c.SignerSocket == "" {
+		if c.SignerAlgorithm != "" {
+			return errors.New("signer algorithm is only used with a signer command or signer socket")
+		}
+		return nil
+	}
+	switch c.SignerAlgorithm {
+	case schema.AlgoEd25519, schema.AlgoECDSA:
+		return nil
+	}
+	return fmt.Errorf("signer algorithm should be %s or %s, not %q", schema.AlgoEd25519, schema.AlgoECDSA, c.SignerAlgorithm)
+}
+
+func countSet(sources ...string) int {
+	n := 0
+	for _, source := range sources {
+		if source != "" {
+			n++
+		}
+	}
+	return n
+}
+
 func (c *KeyConfig) IsEmpty() bool {
 	return c.BaseConfig.IsEmpty() && c.ClientID == ""
 }
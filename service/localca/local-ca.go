@@ -0,0 +1,292 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package localca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	CACertFile   = "ca.pem"
+	caKeyFile    = "ca-key.pem"
+	leafCertFile = "localhost.pem"
+	leafKeyFile  = "localhost-key.pem"
+
+	caName = "httpsignature-proxy local CA"
+
+	caValidity = 10 * 365 * 24 * time.Hour
+	// leafValidity stays below the 398 days accepted by the browsers and the Apple platforms.
+	leafValidity = 397 * 24 * time.Hour
+	// leafRenewal is the remaining validity below which the stored leaf certificate is replaced.
+	leafRenewal = 30 * 24 * time.Hour
+)
+
+// LocalhostNames are the names of the certificate of the proxy TLS listener.
+var LocalhostNames = []string{"localhost", "127.0.0.1", "::1"}
+
+// CA is the local root certificate authority which issues the certificates of the proxy.
+// It is only trusted by the clients which import its certificate, see CertificatePEM.
+type CA struct {
+	dir  string
+	cert *x509.Certificate
+	key  crypto.Signer
+	pem  []byte
+
+	mu    sync.Mutex
+	certs map[string]*tls.Certificate
+}
+
+// LoadOrCreate loads the CA stored in the directory, it is created on the first run.
+func LoadOrCreate(dir string) (*CA, error) {
+	certPEM, certErr := os.ReadFile(filepath.Join(dir, CACertFile))
+	keyPEM, keyErr := os.ReadFile(filepath.Join(dir, caKeyFile))
+	if os.IsNotExist(certErr) && os.IsNotExist(keyErr) {
+		return create(dir)
+	}
+	if certErr != nil {
+		return nil, errors.Wrap(certErr, "read CA certificate")
+	}
+	if keyErr != nil {
+		return nil, errors.Wrap(keyErr, "read CA key")
+	}
+	cert, key, err := parsePair(certPEM, keyPEM)
+	if err != nil {
+		return nil, errors.Wrap(err, "CA")
+	}
+	return &CA{dir: dir, cert: cert, key: key, pem: certPEM}, nil
+}
+
+func create(dir string) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate CA key")
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: caName, Organization: []string{caName}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		SubjectKeyId:          keyID(&key.PublicKey),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "create CA certificate")
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse CA certificate")
+	}
+	certPEM, keyPEM, err := encodePair(der, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.Wrap(err, "create CA directory")
+	}
+	if err := os.WriteFile(filepath.Join(dir, caKeyFile), keyPEM, 0o600); err != nil {
+		return nil, errors.Wrap(err, "write CA key")
+	}
+	if err := os.WriteFile(filepath.Join(dir, CACertFile), certPEM, 0o644); err != nil {
+		return nil, errors.Wrap(err, "write CA certificate")
+	}
+	return &CA{dir: dir, cert: cert, key: key, pem: certPEM}, nil
+}
+
+// CertificatePEM returns the PEM encoded CA certificate which the clients import to trust the proxy.
+func (ca *CA) CertificatePEM() []byte {
+	return ca.pem
+}
+
+// CertificateFile returns the path of the CA certificate.
+func (ca *CA) CertificateFile() string {
+	return filepath.Join(ca.dir, CACertFile)
+}
+
+// Certificate returns the CA certificate.
+func (ca *CA) Certificate() *x509.Certificate {
+	return ca.cert
+}
+
+// LocalhostCertificate returns the certificate for LocalhostNames. It is stored next to the CA and
+// replaced when it expires soon or was issued by another CA.
+func (ca *CA) LocalhostCertificate() (*tls.Certificate, error) {
+	certPEM, certErr := os.ReadFile(filepath.Join(ca.dir, leafCertFile))
+	keyPEM, keyErr := os.ReadFile(filepath.Join(ca.dir, leafKeyFile))
+	if certErr == nil && keyErr == nil {
+		if cert, key, err := parsePair(certPEM, keyPEM); err == nil && ca.valid(cert) {
+			return &tls.Certificate{Certificate: [][]byte{cert.Raw, ca.cert.Raw}, PrivateKey: key, Leaf: cert}, nil
+		}
+	}
+
+	res, err := ca.Issue(LocalhostNames...)
+	if err != nil {
+		return nil, err
+	}
+	certPEM, keyPEM, err = encodePair(res.Certificate[0], res.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(ca.dir, leafKeyFile), keyPEM, 0o600); err != nil {
+		return nil, errors.Wrap(err, "write localhost key")
+	}
+	if err := os.WriteFile(filepath.Join(ca.dir, leafCertFile), certPEM, 0o644); err != nil {
+		return nil, errors.Wrap(err, "write localhost certificate")
+	}
+	return res, nil
+}
+
+// CertificateFor returns a certificate for the host, it is issued on the first call and kept in
+// memory until it expires soon.
+func (ca *CA) CertificateFor(host string) (*tls.Certificate, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if cert, ok := ca.certs[host]; ok && time.Now().Add(leafRenewal).Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+	cert, err := ca.Issue(host)
+	if err != nil {
+		return nil, err
+	}
+	if ca.certs == nil {
+		ca.certs = make(map[string]*tls.Certificate)
+	}
+	ca.certs[host] = cert
+	return cert, nil
+}
+
+func (ca *CA) valid(cert *x509.Certificate) bool {
+	return time.Now().Add(leafRenewal).Before(cert.NotAfter) && cert.CheckSignatureFrom(ca.cert) == nil
+}
+
+// Issue creates a server certificate for the host names and IP addresses, signed by the CA.
+func (ca *CA) Issue(hosts ...string) (*tls.Certificate, error) {
+	if len(hosts) == 0 {
+		return nil, errors.New("no host for the certificate")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate key")
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:   serial,
+		Subject:        pkix.Name{CommonName: hosts[0], Organization: []string{caName}},
+		NotBefore:      now.Add(-time.Hour),
+		NotAfter:       now.Add(leafValidity),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		AuthorityKeyId: ca.cert.SubjectKeyId,
+	}
+	if template.NotAfter.After(ca.cert.NotAfter) {
+		template.NotAfter = ca.cert.NotAfter
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, errors.Wrap(err, "create certificate")
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse certificate")
+	}
+	return &tls.Certificate{Certificate: [][]byte{der, ca.cert.Raw}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+func serialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return serial, errors.Wrap(err, "serial number")
+}
+
+func keyID(pub *ecdsa.PublicKey) []byte {
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	sum := sha256.Sum256(der)
+	return sum[:20]
+}
+
+func encodePair(der []byte, key *ecdsa.PrivateKey) ([]byte, []byte, error) {
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "MarshalPKCS8PrivateKey")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), nil
+}
+
+func parsePair(certPEM, keyPEM []byte) (*x509.Certificate, crypto.Signer, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, errors.New("no PEM data")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parse certificate")
+	}
+	pk, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parse key")
+	}
+	key, ok := pk.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("unsupported key")
+	}
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "MarshalPKIXPublicKey")
+	}
+	certPub, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil || !bytes.Equal(pub, certPub) {
+		return nil, nil, errors.New("the key does not match the certificate")
+	}
+	return cert, key, nil
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package localca
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadOrCreate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tls")
+	ca, err := LoadOrCreate(dir)
+	require.NoError(t, err)
+	assert.True(t, ca.Certificate().IsCA)
+	info, err := os.Stat(filepath.Join(dir, caKeyFile))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	loaded, err := LoadOrCreate(dir)
+	require.NoError(t, err)
+	assert.Equal(t, ca.CertificatePEM(), loaded.CertificatePEM())
+
+	cert, err := ca.LocalhostCertificate()
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Certificate())
+	for _, name := range LocalhostNames {
+		_, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: pool})
+		assert.NoError(t, err, name)
+	}
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: pool})
+	assert.Error(t, err)
+
+	stored, err := loaded.LocalhostCertificate()
+	require.NoError(t, err)
+	assert.Equal(t, cert.Leaf.Raw, stored.Leaf.Raw)
+
+	// a certificate of another CA is replaced
+	other, err := LoadOrCreate(filepath.Join(t.TempDir(), "other"))
+	require.NoError(t, err)
+	require.NoError(t, os.Rename(filepath.Join(dir, leafCertFile), filepath.Join(other.dir, leafCertFile)))
+	require.NoError(t, os.Rename(filepath.Join(dir, leafKeyFile), filepath.Join(other.dir, leafKeyFile)))
+	replaced, err := other.LocalhostCertificate()
+	require.NoError(t, err)
+	assert.NotEqual(t, cert.Leaf.Raw, replaced.Leaf.Raw)
+	assert.NoError(t, replaced.Leaf.CheckSignatureFrom(other.Certificate()))
+}
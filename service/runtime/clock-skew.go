@@ -0,0 +1,137 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/logger"
+	"github.com/upvestco/httpsignature-proxy/service/signer"
+	"github.com/upvestco/httpsignature-proxy/service/signer/material"
+)
+
+// clockSkewHeader is added to the upstream responses rejecting a signature and tells
+// whether the clock skew is a likely cause.
+var clockSkewHeader = http.CanonicalHeaderKey("httpsignature-proxy-clock-skew")
+
+// dateResolution is the resolution of the Date header, smaller differences are not corrected.
+const dateResolution = time.Second
+
+// clockSkew is the difference between the signer clock and the server clock, estimated
+// from the Date header of an upstream response.
+type clockSkew struct {
+	skew  time.Duration
+	known bool
+	// unknown tells why the skew is not known.
+	unknown string
+}
+
+func (s clockSkew) exceeds(threshold time.Duration) bool {
+	return s.known && (s.skew > threshold || s.skew < -threshold)
+}
+
+func (s clockSkew) String() string {
+	switch {
+	case s.skew > 0:
+		return fmt.Sprintf("local clock is %s behind the server", s.skew)
+	case s.skew < 0:
+		return fmt.Sprintf("local clock is %s ahead of the server", -s.skew)
+	}
+	return "local clock matches the server"
+}
+
+// skewWarnings remembers the clients already warned about the clock skew, so the warning
+// is printed once per drift instead of once per request.
+type skewWarnings struct {
+	lock   sync.Mutex
+	warned map[string]bool
+}
+
+func (w *skewWarnings) set(clientID string, warned bool) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.warned == nil {
+		w.warned = make(map[string]bool)
+	}
+	changed := w.warned[clientID] != warned
+	w.warned[clientID] = warned
+	return changed
+}
+
+func (h *Handler) clockSkewThreshold() time.Duration {
+	if h.cfg.ClockSkewThreshold > 0 {
+		return h.cfg.ClockSkewThreshold
+	}
+	return config.DefaultClockSkewThreshold
+}
+
+// observeClockSkew compares the clock used for the request signature with the Date header of the
+// upstream response. It warns when the skew passes the threshold and corrects the signer clock
+// when the key config uses the automatic clock offset.
+func (h *Handler) observeClockSkew(clientID string, signerCfg SignerConfig, opts *material.Options, resp *http.Response,
+	sent, received time.Time, ll logger.Logger) clockSkew {
+	offset, err := signer.ClockOffset(resp.Header, sent, received)
+	if err != nil {
+		return clockSkew{unknown: "the response has no Date header"}
+	}
+	threshold := h.clockSkewThreshold()
+	// the server sets the Date header anywhere between sent and received, so the estimate is off by
+	// up to half of the round trip, a slow upload or response looks like a clock behind the server
+	roundTrip := received.Sub(sent)
+	if roundTrip > threshold {
+		return clockSkew{unknown: fmt.Sprintf("the round trip of %s is too slow to estimate it", roundTrip.Round(time.Millisecond))}
+	}
+	var clock *material.Clock
+	if opts != nil {
+		clock = opts.Clock
+	}
+	skew := clockSkew{skew: offset - clock.Offset(), known: true}
+
+	if skew.exceeds(threshold) {
+		if h.skewWarnings.set(clientID, true) {
+			ll.PrintF("Warning: %s (%s), signatures may be rejected\n", skew, signerCfg.KeyConfig.BaseUrl)
+		}
+	} else if h.skewWarnings.set(clientID, false) {
+		ll.LogF(" - Clock skew is back within %s", threshold)
+	}
+
+	if signerCfg.KeyConfig.AutoClockOffset && clock != nil && skew.exceeds(dateResolution+roundTrip/2) {
+		clock.SetOffset(offset)
+		ll.PrintF("Clock offset for %s corrected to %s\n", signerCfg.KeyConfig.BaseUrl, offset)
+	}
+	return skew
+}
+
+// isSignatureRejection reports the upstream status codes returned for invalid signatures.
+func isSignatureRejection(code int) bool {
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+// clockSkewHint explains whether the clock skew is a likely cause of the rejected signature.
+func (h *Handler) clockSkewHint(skew clockSkew) string {
+	switch {
+	case !skew.known:
+		return "unknown, " + skew.unknown
+	case skew.exceeds(h.clockSkewThreshold()):
+		return fmt.Sprintf("%s, likely cause of the rejected signature", skew)
+	}
+	return fmt.Sprintf("%s, unlikely cause of the rejected signature", skew)
+}
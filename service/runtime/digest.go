@@ -0,0 +1,55 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"net/http"
+
+	"github.com/upvestco/httpsignature-proxy/service/logger"
+	"github.com/upvestco/httpsignature-proxy/service/signer/material"
+)
+
+// observeWantDigest switches the Content-Digest algorithm of the signer to the one
+// the upstream asks for with the Want-Content-Digest header.
+func (h *Handler) observeWantDigest(opts *material.Options, resp *http.Response, ll logger.Logger) {
+	value := resp.Header.Get(material.WantContentDigestHeader)
+	if value == "" || opts == nil || opts.Digest == nil {
+		return
+	}
+	if opts.Digest.Want(value) {
+		ll.PrintF("Upstream wants Content-Digest %s, switched to %s\n", value, opts.Digest.Algorithm())
+	}
+}
+
+// verifyResponseDigest logs the upstream responses which do not match their Content-Digest header.
+func (h *Handler) verifyResponseDigest(resp *http.Response, data []byte, ll logger.Logger) {
+	value := resp.Header.Get(material.ContentDigestHeader)
+	switch {
+	case value == "":
+		ll.Log(" - Response has no Content-Digest header")
+	case resp.Uncompressed:
+		// the digest covers the compressed content which is already decoded by the transport
+		ll.Log(" - Response Content-Digest is not verified, the response was decompressed")
+	default:
+		if err := material.VerifyContentDigest(value, data); err != nil {
+			ll.PrintF("Warning: response of %s %s failed Content-Digest verification: %s\n",
+				resp.Request.Method, resp.Request.URL.String(), err.Error())
+			return
+		}
+		ll.Log(" - Response Content-Digest verified")
+	}
+}
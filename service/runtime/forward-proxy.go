@@ -0,0 +1,233 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/upvestco/httpsignature-proxy/service/logger"
+)
+
+/*
+Forward proxy mode: the clients use the proxy with HTTPS_PROXY / HTTP_PROXY. The requests to the
+hosts of the key configs are signed, CONNECT to such a host is answered by the proxy itself with a
+certificate of the local CA. Every other host is tunneled or forwarded untouched. */
+
+var (
+	proxyConnectionHeader    = http.CanonicalHeaderKey("proxy-connection")
+	proxyAuthorizationHeader = http.CanonicalHeaderKey("proxy-authorization")
+)
+
+// serveForward handles the requests of a forward proxy client, it returns false when the request
+// is to be signed by the handler.
+func (h *Handler) serveForward(rw http.ResponseWriter, inReq *http.Request, ll logger.Logger) bool {
+	if inReq.Method == http.MethodConnect {
+		if h.intercepts(withPort(inReq.Host, "https")) {
+			h.intercept(rw, inReq, ll)
+		} else {
+			h.tunnel(rw, inReq, ll)
+		}
+		return true
+	}
+	if !inReq.URL.IsAbs() {
+		return false
+	}
+	inReq.Header.Del(proxyConnectionHeader)
+	inReq.Header.Del(proxyAuthorizationHeader)
+	if h.intercepts(inReq.URL.Host) {
+		return false
+	}
+	ll.LogF("\nForward request to %s untouched", inReq.URL.Host)
+	forward := &httputil.ReverseProxy{Director: func(*http.Request) {}}
+	forward.ServeHTTP(rw, inReq)
+	return true
+}
+
+// intercepts reports that the host is the host of a base URL or route of a key config, so its
+// requests are signed. The key config selected by the client ID has to cover the host as well,
+// see selectUpstream.
+func (h *Handler) intercepts(host string) bool {
+	for _, signerCfg := range h.signerConfigs.All() {
+		if coveringBaseUrl(signerCfg.KeyConfig, host) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// withPort adds the default port of the scheme to the host without a port.
+func withPort(host, scheme string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	if scheme == "http" {
+		return net.JoinHostPort(host, "80")
+	}
+	return net.JoinHostPort(host, "443")
+}
+
+// intercept terminates the TLS connection of the client with a certificate for the host issued by
+// the local CA and signs the requests sent over it.
+func (h *Handler) intercept(rw http.ResponseWriter, inReq *http.Request, ll logger.Logger) {
+	host := inReq.Host
+	if h.ca == nil {
+		h.writeError(rw, http.StatusInternalServerError, errors.New("no local CA to intercept "+host))
+		return
+	}
+	conn, err := h.hijack(rw)
+	if err != nil {
+		h.writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	defer h.release(conn)
+	ll.LogF("\nIntercept CONNECT to %s", host)
+	hostname, _, _ := net.SplitHostPort(host)
+	tlsConn := tls.Server(conn, &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return h.ca.CertificateFor(hostname)
+		},
+	})
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			req.URL.Scheme = "https"
+			req.URL.Host = host
+			h.ServeHTTP(rw, req)
+		}),
+	}
+	_ = server.Serve(&connListener{conn: tlsConn})
+	// the server serves the connection in the background until the client or closeHijacked closes it
+	<-conn.closed
+}
+
+// tunnel connects the client to the host without looking at the traffic.
+func (h *Handler) tunnel(rw http.ResponseWriter, inReq *http.Request, ll logger.Logger) {
+	upstream, err := net.DialTimeout("tcp", inReq.Host, h.cfg.DefaultTimeout)
+	if err != nil {
+		h.writeError(rw, http.StatusBadGateway, err)
+		return
+	}
+	conn, err := h.hijack(rw)
+	if err != nil {
+		_ = upstream.Close()
+		h.writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	defer h.release(conn)
+	ll.LogF("\nTunnel CONNECT to %s", inReq.Host)
+	go func() {
+		_, _ = io.Copy(upstream, conn)
+		_ = upstream.Close()
+	}()
+	_, _ = io.Copy(conn, upstream)
+	_ = conn.Close()
+}
+
+// hijack takes over the connection of the CONNECT request and confirms the tunnel. The connection
+// is closed by closeHijacked until it is released.
+func (h *Handler) hijack(rw http.ResponseWriter) (*hijackedConn, error) {
+	hijacker, ok := rw.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("the connection does not support CONNECT")
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return nil, errors.Wrap(err, "Hijack")
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, "CONNECT response")
+	}
+	res := &hijackedConn{Conn: conn, r: conn, closed: make(chan struct{})}
+	if buf.Reader.Buffered() > 0 {
+		// the client started the handshake before the response
+		res.r = io.MultiReader(io.LimitReader(buf.Reader, int64(buf.Reader.Buffered())), conn)
+	}
+	h.hijackedLock.Lock()
+	defer h.hijackedLock.Unlock()
+	if h.hijacked == nil {
+		h.hijacked = make(map[*hijackedConn]struct{})
+	}
+	h.hijacked[res] = struct{}{}
+	return res, nil
+}
+
+func (h *Handler) release(conn *hijackedConn) {
+	h.hijackedLock.Lock()
+	defer h.hijackedLock.Unlock()
+	delete(h.hijacked, conn)
+}
+
+// closeHijacked closes the CONNECT connections, the server does not track them after the hijack.
+func (h *Handler) closeHijacked() {
+	h.hijackedLock.Lock()
+	defer h.hijackedLock.Unlock()
+	for conn := range h.hijacked {
+		_ = conn.Close()
+	}
+}
+
+type hijackedConn struct {
+	net.Conn
+	r      io.Reader
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (c *hijackedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *hijackedConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+	return c.Conn.Close()
+}
+
+// connListener accepts the single connection, http.Server then serves it until it is closed.
+type connListener struct {
+	conn net.Conn
+	once sync.Once
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	var conn net.Conn
+	l.once.Do(func() {
+		conn = l.conn
+	})
+	if conn == nil {
+		return nil, io.EOF
+	}
+	return conn, nil
+}
+
+func (l *connListener) Close() error {
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
@@ -0,0 +1,181 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/localca"
+	"github.com/upvestco/httpsignature-proxy/service/signer/material"
+)
+
+func TestHandler_ForwardProxy(t *testing.T) {
+	var signed, untouched http.Header
+	upvest := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signed = r.Header.Clone()
+	}))
+	defer upvest.Close()
+	other := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		untouched = r.Header.Clone()
+	}))
+	defer other.Close()
+
+	// the proxy trusts the test servers
+	transport := http.DefaultTransport
+	http.DefaultTransport = upvest.Client().Transport
+	defer func() {
+		http.DefaultTransport = transport
+	}()
+
+	h, clientID := newTestHandler(t, upvest.URL, nil)
+	h.cfg.ForwardProxy = true
+	ca, err := localca.LoadOrCreate(t.TempDir())
+	require.NoError(t, err)
+	h.ca = ca
+	proxy := httptest.NewServer(h)
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Certificate())
+	pool.AddCert(other.Certificate())
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{RootCAs: pool},
+	}}
+
+	req, err := http.NewRequest(http.MethodPost, upvest.URL+"/endpoint", strings.NewReader("This is the body"))
+	require.NoError(t, err)
+	req.Header.Set(upvestClientID, clientID.String())
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEmpty(t, signed.Get(material.SignatureHeader))
+	assert.Equal(t, "CN=127.0.0.1,O=httpsignature-proxy local CA", resp.TLS.PeerCertificates[0].Subject.String())
+
+	resp, err = client.Get(other.URL + "/other")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotNil(t, untouched)
+	assert.Empty(t, untouched.Get(material.SignatureHeader))
+}
+
+// TestHandler_ForwardProxyHosts sends the requests of two key configs with different hosts through
+// the forward proxy, a key config only signs the requests to its own hosts.
+func TestHandler_ForwardProxyHosts(t *testing.T) {
+	type received struct {
+		server, path, signature string
+	}
+	var last received
+	server := func(name string) *httptest.Server {
+		return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			last = received{server: name, path: r.URL.Path, signature: r.Header.Get(material.SignatureHeader)}
+		}))
+	}
+	sandbox, staging := server("sandbox"), server("staging")
+	defer sandbox.Close()
+	defer staging.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(sandbox.Certificate())
+	pool.AddCert(staging.Certificate())
+	transport := http.DefaultTransport
+	http.DefaultTransport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	defer func() {
+		http.DefaultTransport = transport
+	}()
+
+	h, sandboxID := newTestHandlerWithConfig(t, nil, privateTestKey, config.BaseConfig{
+		BaseUrl:  sandbox.URL,
+		Password: testPass,
+		KeyID:    testKeyID,
+		Routes:   []config.Route{{PathPrefix: "/v2", RewritePathPrefix: "/api/v2", BaseUrl: sandbox.URL}},
+	})
+	staged, stagingID := newTestHandlerWithConfig(t, nil, privateTestKey, config.BaseConfig{
+		BaseUrl:  staging.URL,
+		Password: testPass,
+		KeyID:    testKeyID,
+	})
+	signerConfigs := make(map[string]SignerConfig)
+	for _, c := range []*Handler{h, staged} {
+		for clientID, signerCfg := range c.signerConfigs.All() {
+			signerConfigs[clientID] = signerCfg
+		}
+	}
+	h.signerConfigs.Replace(signerConfigs)
+	h.cfg.ForwardProxy = true
+	ca, err := localca.LoadOrCreate(t.TempDir())
+	require.NoError(t, err)
+	h.ca = ca
+	proxy := httptest.NewServer(h)
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+	caPool := x509.NewCertPool()
+	caPool.AddCert(ca.Certificate())
+	client := &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{RootCAs: caPool},
+	}}
+
+	tests := []struct {
+		name     string
+		clientID string
+		url      string
+		code     int
+		expected received
+	}{
+		{name: "own host", clientID: sandboxID.String(), url: sandbox.URL + "/accounts", code: http.StatusOK, expected: received{server: "sandbox", path: "/accounts"}},
+		{name: "route", clientID: sandboxID.String(), url: sandbox.URL + "/v2/orders", code: http.StatusOK, expected: received{server: "sandbox", path: "/api/v2/orders"}},
+		{name: "other key config", clientID: stagingID.String(), url: staging.URL + "/accounts", code: http.StatusOK, expected: received{server: "staging", path: "/accounts"}},
+		{name: "host of another key config", clientID: sandboxID.String(), url: staging.URL + "/accounts", code: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			last = received{}
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			require.NoError(t, err)
+			req.Header.Set(upvestClientID, tt.clientID)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+			assert.Equal(t, tt.code, resp.StatusCode)
+			if tt.code != http.StatusOK {
+				assert.Equal(t, received{}, last)
+				return
+			}
+			assert.NotEmpty(t, last.signature)
+			last.signature = ""
+			assert.Equal(t, tt.expected, last)
+		})
+	}
+}
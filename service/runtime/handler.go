@@ -24,10 +24,13 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 
+	"github.com/upvestco/httpsignature-proxy/service/localca"
 	"github.com/upvestco/httpsignature-proxy/service/logger"
 	"github.com/upvestco/httpsignature-proxy/service/signer"
 	"github.com/upvestco/httpsignature-proxy/service/tunnels"
@@ -51,18 +54,24 @@ var (
 )
 
 type Handler struct {
-	signerConfigs     map[string]SignerConfig
+	signerConfigs     *SignerConfigs
 	cfg               *config.Config
 	requestSigner     request.Signer
 	log               logger.Logger
 	userCredentialsCh chan tunnels.UserCredentials
+	skewWarnings      skewWarnings
+	// ca issues the certificates of the hosts intercepted in the forward proxy mode.
+	ca *localca.CA
+	// hijacked are the CONNECT connections of the forward proxy mode.
+	hijacked     map[*hijackedConn]struct{}
+	hijackedLock sync.Mutex
 }
 
-func newHandler(cfg *config.Config, signerConfigs map[string]SignerConfig, userCredentialsCh chan tunnels.UserCredentials, log logger.Logger) *Handler {
+func newHandler(cfg *config.Config, signerConfigs *SignerConfigs, userCredentialsCh chan tunnels.UserCredentials, log logger.Logger) *Handler {
 	return &Handler{
 		cfg:               cfg,
 		log:               log,
-		requestSigner:     request.New(log),
+		requestSigner:     request.NewWithExplain(log, cfg.Explain),
 		signerConfigs:     signerConfigs,
 		userCredentialsCh: userCredentialsCh,
 	}
@@ -139,7 +148,7 @@ func (h *Handler) excludeHeader(headerName string) bool {
 }
 
 func (h *Handler) getSignerConfig(clientID string, ll logger.Logger) (SignerConfig, error) {
-	signerCfg, ok := h.signerConfigs[clientID]
+	signerCfg, ok := h.signerConfigs.Get(clientID)
 	if !ok {
 		return h.getDefaultSigner(ll)
 	}
@@ -147,7 +156,7 @@ func (h *Handler) getSignerConfig(clientID string, ll logger.Logger) (SignerConf
 	return signerCfg, nil
 }
 func (h *Handler) getDefaultSigner(ll logger.Logger) (SignerConfig, error) {
-	signerCfg, ok := h.signerConfigs[config.DefaultClientKey]
+	signerCfg, ok := h.signerConfigs.Get(config.DefaultClientKey)
 	if !ok {
 		return SignerConfig{}, errors.New("unknown clientID, please, check your signing proxy configuration")
 	}
@@ -190,6 +199,9 @@ func (h *Handler) ServeHTTP(rw http.ResponseWriter, inReq *http.Request) {
 	if len(inReq.Header.Get(logger.HttpProxyNoLogging)) > 0 {
 		ll = logger.NoVerboseLogger
 	}
+	if h.cfg.ForwardProxy && h.serveForward(rw, inReq, ll) {
+		return
+	}
 	requestBody := h.proxy(rw, inReq, ll)
 	path := inReq.URL.Path
 	if path == tokenEndpoint && requestBody != nil {
@@ -209,8 +221,6 @@ func (h *Handler) ServeHTTP(rw http.ResponseWriter, inReq *http.Request) {
 
 func (h *Handler) proxy(rw http.ResponseWriter, inReq *http.Request, ll logger.Logger) []byte {
 	ll.Log("\nSend request:")
-	ctx, cancel := context.WithTimeout(inReq.Context(), h.cfg.DefaultTimeout)
-	defer cancel()
 
 	clientID, err := h.getClientID(inReq)
 	if err != nil {
@@ -227,16 +237,27 @@ func (h *Handler) proxy(rw http.ResponseWriter, inReq *http.Request, ll logger.L
 		return nil
 	}
 
-	toUrl, err := url.Parse(signerCfg.KeyConfig.BaseUrl)
+	target, err := selectUpstream(signerCfg.KeyConfig, inReq, h.cfg.DefaultTimeout)
+	if errors.Is(err, ErrHostNotCovered) {
+		ll.LogF("Client ID %s does not sign the requests to %s", clientID, inReq.URL.Host)
+		h.writeError(rw, http.StatusForbidden, err)
+		return nil
+	}
 	if err != nil {
 		ll.Log("Wrong base URL")
 		h.writeError(rw, http.StatusInternalServerError, err)
 		return nil
 	}
-	toUrl.Path = inReq.URL.Path
-
-	toUrl.RawQuery = inReq.URL.RawQuery
+	toUrl := target.url
+	if target.route != nil {
+		ll.LogF(" - Routed by %s", target.route.String())
+		if target.route.Header != "" {
+			inReq.Header.Del(target.route.Header)
+		}
+	}
 	ll.LogF(" - To url '%s'", toUrl.String())
+	ctx, cancel := context.WithTimeout(inReq.Context(), target.timeout)
+	defer cancel()
 
 	requestBody, err := io.ReadAll(inReq.Body)
 	if err != nil {
@@ -257,7 +278,9 @@ func (h *Handler) proxy(rw http.ResponseWriter, inReq *http.Request, ll logger.L
 
 	httpClient := signer.NewHTTPClient(h.requestSigner, sign, ll, inReq)
 
+	sent := time.Now()
 	resp, err := httpClient.Do(outReq)
+	received := time.Now()
 	if err != nil {
 		switch {
 		case errors.Is(err, context.DeadlineExceeded):
@@ -280,6 +303,18 @@ func (h *Handler) proxy(rw http.ResponseWriter, inReq *http.Request, ll logger.L
 		return nil
 	}
 
+	h.observeWantDigest(sign.MaterialOptions(), resp, ll)
+	if h.cfg.VerifyDigests {
+		h.verifyResponseDigest(resp, data, ll)
+	}
+
+	skew := h.observeClockSkew(clientID, signerCfg, sign.MaterialOptions(), resp, sent, received, ll)
+	if isSignatureRejection(resp.StatusCode) {
+		hint := h.clockSkewHint(skew)
+		ll.PrintF("Request rejected with status %d, clock skew: %s\n", resp.StatusCode, hint)
+		resp.Header.Set(clockSkewHeader, hint)
+	}
+
 	ll.Log("\n=====================")
 	ll.Log("Response:")
 	ll.LogF(" - Status '%d'", resp.StatusCode)
@@ -17,6 +17,9 @@ limitations under the License.
 package runtime
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -30,28 +33,35 @@ import (
 	"github.com/upvestco/httpsignature-proxy/config"
 	"github.com/upvestco/httpsignature-proxy/service/logger"
 	"github.com/upvestco/httpsignature-proxy/service/signer"
+	"github.com/upvestco/httpsignature-proxy/service/signer/material"
 	"github.com/upvestco/httpsignature-proxy/service/tunnels"
+	"golang.org/x/crypto/ssh"
 )
 
 func newTestHandler(t *testing.T, backendURL string, ch chan tunnels.UserCredentials) (*Handler, uuid.UUID) {
+	t.Helper()
+	return newTestHandlerWithConfig(t, ch, privateTestKey, config.BaseConfig{
+		BaseUrl:  backendURL,
+		Password: testPass,
+		KeyID:    testKeyID,
+	})
+}
+
+func newTestHandlerWithConfig(t *testing.T, ch chan tunnels.UserCredentials, keyData string, baseCfg config.BaseConfig) (*Handler, uuid.UUID) {
 	t.Helper()
 	clientID := uuid.New()
 	keyCfg := config.KeyConfig{
-		BaseConfig: config.BaseConfig{
-			BaseUrl:  backendURL,
-			Password: testPass,
-			KeyID:    testKeyID,
-		},
-		ClientID: clientID.String(),
+		BaseConfig: baseCfg,
+		ClientID:   clientID.String(),
 	}
-	builder, err := signer.NewLocalPrivateSchemeBuilderFromSeed(privateTestKey, &keyCfg)
+	builder, err := signer.NewLocalPrivateSchemeBuilderFromSeed(keyData, &keyCfg)
 	require.NoError(t, err)
 
 	signerConfigs := map[string]SignerConfig{
 		clientID.String(): {SignBuilder: builder, KeyConfig: keyCfg.BaseConfig},
 	}
 	cfg := &config.Config{DefaultTimeout: 30 * time.Second}
-	return newHandler(cfg, signerConfigs, ch, logger.New(false)), clientID
+	return newHandler(cfg, NewSignerConfigs(signerConfigs), ch, logger.New(false)), clientID
 }
 
 func TestHandler_AuthToken_DoesNotBlockWithoutChannelReader(t *testing.T) {
@@ -106,3 +116,134 @@ func TestHandler_AuthToken_ForwardsCredentialsToChannel(t *testing.T) {
 		t.Fatal("expected credentials on channel")
 	}
 }
+
+func TestHandler_SignsWithEd25519Key(t *testing.T) {
+	_, pk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(pk, "", []byte(testPass))
+	require.NoError(t, err)
+
+	var received http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	h, clientID := newTestHandlerWithConfig(t, nil, string(pem.EncodeToMemory(block)), config.BaseConfig{
+		BaseUrl:  backend.URL,
+		Password: testPass,
+		KeyID:    testKeyID,
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/endpoint", strings.NewReader("This is the body"))
+	req.Header.Set(upvestClientID, clientID.String())
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, received)
+	assert.NotEmpty(t, received.Get(material.SignatureHeader))
+	assert.Contains(t, received.Get(material.SignatureInputHeader), `keyid="`+testKeyID+`"`)
+}
+
+func TestHandler_MissingRequiredComponent(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request without the required component must not be sent")
+	}))
+	defer backend.Close()
+
+	h, clientID := newTestHandlerWithConfig(t, nil, privateTestKey, config.BaseConfig{
+		BaseUrl:            backend.URL,
+		Password:           testPass,
+		KeyID:              testKeyID,
+		RequiredComponents: []string{"idempotency-key"},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/endpoint", strings.NewReader("This is the body"))
+	req.Header.Set(upvestClientID, clientID.String())
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "idempotency-key")
+}
+
+func TestHandler_ClockSkew(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(2*time.Minute).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer backend.Close()
+
+	h, clientID := newTestHandlerWithConfig(t, nil, privateTestKey, config.BaseConfig{
+		BaseUrl:         backend.URL,
+		Password:        testPass,
+		KeyID:           testKeyID,
+		AutoClockOffset: true,
+	})
+	signerCfg, _ := h.signerConfigs.Get(clientID.String())
+	clock := signerCfg.SignBuilder.GetDefaultPrivateKey().MaterialOptions().Clock
+
+	req := httptest.NewRequest(http.MethodGet, "/endpoint", nil)
+	req.Header.Set(upvestClientID, clientID.String())
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get(clockSkewHeader), "behind the server, likely cause")
+	assert.InDelta(t, (2 * time.Minute).Seconds(), clock.Offset().Seconds(), 1)
+
+	// the next request is signed with the corrected clock
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Contains(t, rec.Header().Get(clockSkewHeader), "unlikely cause")
+}
+
+func TestHandler_ClockSkewSlowResponse(t *testing.T) {
+	h, clientID := newTestHandlerWithConfig(t, nil, privateTestKey, config.BaseConfig{
+		BaseUrl:         "http://localhost",
+		Password:        testPass,
+		KeyID:           testKeyID,
+		AutoClockOffset: true,
+	})
+	signerCfg, _ := h.signerConfigs.Get(clientID.String())
+	opts := signerCfg.SignBuilder.GetDefaultPrivateKey().MaterialOptions()
+
+	// the server clock matches, but the Date header is set at the end of a slow exchange
+	received := time.Now().Truncate(time.Second)
+	resp := &http.Response{Header: http.Header{"Date": []string{received.UTC().Format(http.TimeFormat)}}}
+
+	skew := h.observeClockSkew(clientID.String(), signerCfg, opts, resp, received.Add(-20*time.Second), received, logger.New(false))
+	assert.True(t, skew.known)
+	assert.Equal(t, time.Duration(0), opts.Clock.Offset())
+
+	skew = h.observeClockSkew(clientID.String(), signerCfg, opts, resp, received.Add(-time.Minute), received, logger.New(false))
+	assert.False(t, skew.known)
+	assert.Contains(t, h.clockSkewHint(skew), "too slow")
+	assert.Equal(t, time.Duration(0), opts.Clock.Offset())
+}
+
+func TestHandler_WantContentDigest(t *testing.T) {
+	var digests []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		digests = append(digests, r.Header.Get(material.ContentDigestHeader))
+		w.Header().Set(material.WantContentDigestHeader, "sha-256=10, sha-512=1")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	h, clientID := newTestHandler(t, backend.URL, nil)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/endpoint", strings.NewReader("This is the body"))
+		req.Header.Set(upvestClientID, clientID.String())
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	require.Len(t, digests, 2)
+	assert.True(t, strings.HasPrefix(digests[0], "sha-512=:"), digests[0])
+	assert.True(t, strings.HasPrefix(digests[1], "sha-256=:"), digests[1])
+}
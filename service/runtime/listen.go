@@ -0,0 +1,144 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/upvestco/httpsignature-proxy/config"
+)
+
+// UnixSocketPrefix starts the listen address of a unix socket, e.g. unix:/run/proxy.sock.
+const UnixSocketPrefix = "unix:"
+
+// DefaultSocketMode lets only the user of the proxy use the unix socket and so the signing keys.
+const DefaultSocketMode os.FileMode = 0o600
+
+// listenAddress returns the configured listen address, localhost with the port by default.
+func listenAddress(cfg *config.Config) string {
+	if cfg.ListenAddress != "" {
+		return cfg.ListenAddress
+	}
+	return net.JoinHostPort("localhost", fmt.Sprintf("%d", cfg.Port))
+}
+
+// tlsListenAddress returns the address of the HTTPS listener, the TLS port on the host of the
+// listen address by default. It is empty when the HTTPS listener is disabled.
+func tlsListenAddress(cfg *config.Config) string {
+	if cfg.TLSListenAddress != "" {
+		return cfg.TLSListenAddress
+	}
+	if cfg.TLSPort == 0 {
+		return ""
+	}
+	host := "localhost"
+	if !strings.HasPrefix(cfg.ListenAddress, UnixSocketPrefix) {
+		if h, _, err := net.SplitHostPort(cfg.ListenAddress); err == nil {
+			host = h
+		}
+	}
+	return net.JoinHostPort(host, strconv.Itoa(cfg.TLSPort))
+}
+
+// listen listens on the host:port or on the unix socket of the address.
+func listen(address string, socketMode os.FileMode) (net.Listener, error) {
+	path, ok := strings.CutPrefix(address, UnixSocketPrefix)
+	if !ok {
+		listener, err := net.Listen("tcp", address)
+		return listener, errors.Wrap(err, "Listen")
+	}
+	if path == "" {
+		return nil, errors.New("Listen: the unix socket path is empty")
+	}
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, errors.Errorf("Listen: %s exists and is not a socket", path)
+		}
+		// remove the socket left behind by a proxy which did not stop cleanly
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+			return nil, errors.Errorf("Listen: %s is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, errors.Wrap(err, "Listen")
+		}
+	}
+	if socketMode == 0 {
+		socketMode = DefaultSocketMode
+	}
+	// the socket is created with the permissions of the umask, so it is created in a private
+	// directory and only moved into place with the socket mode
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock")
+	if err != nil {
+		return nil, errors.Wrap(err, "Listen")
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	tmp := filepath.Join(dir, "s")
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, errors.Wrap(err, "Listen")
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, socketMode); err != nil {
+		_ = listener.Close()
+		return nil, errors.Wrap(err, "Listen: socket permissions")
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = listener.Close()
+		return nil, errors.Wrap(err, "Listen")
+	}
+	return &socketListener{Listener: listener, addr: &net.UnixAddr{Name: path, Net: "unix"}}, nil
+}
+
+// socketListener is the listener of the socket moved into place, it reports the path of the
+// socket and removes it when it is closed.
+type socketListener struct {
+	net.Listener
+	addr   *net.UnixAddr
+	unlink sync.Once
+}
+
+func (l *socketListener) Addr() net.Addr {
+	return l.addr
+}
+
+func (l *socketListener) Close() error {
+	err := l.Listener.Close()
+	l.unlink.Do(func() {
+		_ = os.Remove(l.addr.Name)
+	})
+	return err
+}
+
+// clientAddress returns the address the clients in the same process use to reach the listener,
+// an http URL or the unix socket address.
+func clientAddress(addr net.Addr) string {
+	if addr.Network() == "unix" {
+		return UnixSocketPrefix + addr.String()
+	}
+	return "http://" + addr.String()
+}
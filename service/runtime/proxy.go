@@ -17,53 +17,206 @@ limitations under the License.
 package runtime
 
 import (
-	"fmt"
+	"context"
+	"crypto/tls"
 	"net"
 	"net/http"
 
 	"github.com/pkg/errors"
 	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/localca"
 	"github.com/upvestco/httpsignature-proxy/service/logger"
 	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
 	"github.com/upvestco/httpsignature-proxy/service/tunnels"
 )
 
+// Proxy signs the requests it receives and sends them to the configured server. Run starts it,
+// Ready and Done are closed when it accepts the requests and when it has stopped, Shutdown stops it.
 type Proxy struct {
 	cfg               *config.Config
-	signerConfigs     map[string]SignerConfig
+	signerConfigs     *SignerConfigs
 	logger            logger.Logger
+	handler           *Handler
 	server            *http.Server
+	tlsServer         *http.Server
+	addr              net.Addr
+	tlsAddr           net.Addr
 	userCredentialsCh chan tunnels.UserCredentials
+
+	ready chan struct{}
+	done  chan struct{}
+	// err is the error which stopped the proxy, it is set before done is closed.
+	err error
 }
 
 type SignerConfig struct {
 	SignBuilder schema.SigningSchemeBuilder
 	KeyConfig   config.BaseConfig
+	// WebhookVerifier checks the signatures of the webhook events, it is nil when no public key is configured.
+	WebhookVerifier *schema.Verifier
 }
 
 func NewProxy(cfg *config.Config, signerConfigs map[string]SignerConfig, userCredentialsCh chan tunnels.UserCredentials, logger logger.Logger) Proxy {
 	return Proxy{
 		cfg:               cfg,
 		logger:            logger,
-		signerConfigs:     signerConfigs,
+		signerConfigs:     NewSignerConfigs(signerConfigs),
 		userCredentialsCh: userCredentialsCh,
+		ready:             make(chan struct{}),
+		done:              make(chan struct{}),
 	}
 }
 
+// Run listens and serves the requests in the background, it returns when the proxy is ready.
 func (r *Proxy) Run() error {
-	addr := net.JoinHostPort("localhost", fmt.Sprintf("%d", r.cfg.Port))
-	listener, err := net.Listen("tcp", addr)
+	listener, err := listen(listenAddress(r.cfg), r.cfg.SocketMode)
 	if err != nil {
-		return errors.Wrap(err, "Listen")
+		return err
 	}
-	handler := newHandler(r.cfg, r.signerConfigs, r.userCredentialsCh, r.logger)
+	r.addr = listener.Addr()
+	r.handler = newHandler(r.cfg, r.signerConfigs, r.userCredentialsCh, r.logger)
 	r.server = &http.Server{
-		Handler: handler,
+		Handler: r.handler,
 	}
-	go func() {
-		if err := r.server.Serve(listener); err != nil {
-			r.logger.PrintLn(err.Error())
+	r.server.RegisterOnShutdown(r.handler.closeHijacked)
+	var tlsListener net.Listener
+	if tlsListenAddress(r.cfg) != "" || r.cfg.ForwardProxy {
+		if tlsListener, err = r.setupTLS(); err != nil {
+			_ = listener.Close()
+			return err
 		}
+	}
+
+	errs := make(chan error, 2)
+	servers := 1
+	go func() {
+		errs <- r.server.Serve(listener)
 	}()
+	if r.tlsServer != nil {
+		servers++
+		go func() {
+			errs <- r.tlsServer.ServeTLS(tlsListener, "", "")
+		}()
+	}
+	go r.wait(errs, servers)
+	close(r.ready)
 	return nil
 }
+
+// wait closes done when the servers have stopped. A server which fails stops the others.
+func (r *Proxy) wait(errs chan error, servers int) {
+	for i := 0; i < servers; i++ {
+		err := <-errs
+		if err == nil || errors.Is(err, http.ErrServerClosed) || r.err != nil {
+			continue
+		}
+		r.err = errors.Wrap(err, "Serve")
+		r.logger.PrintLn(r.err.Error())
+		_ = r.server.Close()
+		if r.tlsServer != nil {
+			_ = r.tlsServer.Close()
+		}
+	}
+	close(r.done)
+}
+
+// setupTLS loads the local CA, which is created on the first run, and listens on the HTTPS address
+// when it is configured.
+func (r *Proxy) setupTLS() (net.Listener, error) {
+	ca, err := localca.LoadOrCreate(r.cfg.TLSDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "local CA")
+	}
+	r.handler.ca = ca
+	addr := tlsListenAddress(r.cfg)
+	if addr == "" {
+		return nil, nil
+	}
+	cert, err := ca.LocalhostCertificate()
+	if err != nil {
+		return nil, errors.Wrap(err, "localhost certificate")
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "Listen TLS")
+	}
+	r.tlsAddr = listener.Addr()
+	r.tlsServer = &http.Server{
+		Handler: r.handler,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{*cert},
+			MinVersion:   tls.VersionTLS12,
+		},
+	}
+	r.tlsServer.RegisterOnShutdown(r.handler.closeHijacked)
+	return listener, nil
+}
+
+// Shutdown stops accepting requests and waits for the requests in flight until the context ends.
+// The tunneled and intercepted CONNECT connections of the forward proxy are closed.
+func (r *Proxy) Shutdown(ctx context.Context) error {
+	select {
+	case <-r.ready:
+	default:
+		return nil
+	}
+	var res error
+	for _, server := range []*http.Server{r.server, r.tlsServer} {
+		if server == nil {
+			continue
+		}
+		if err := server.Shutdown(ctx); err != nil && res == nil {
+			res = errors.Wrap(err, "Shutdown")
+		}
+	}
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		if res == nil {
+			res = errors.Wrap(ctx.Err(), "Shutdown")
+		}
+	}
+	return res
+}
+
+// Ready is closed when Run has started to serve the requests.
+func (r *Proxy) Ready() <-chan struct{} {
+	return r.ready
+}
+
+// Done is closed when the proxy has stopped, by Shutdown or because a server failed, see Err.
+func (r *Proxy) Done() <-chan struct{} {
+	return r.done
+}
+
+// Err returns the error which stopped the proxy once Done is closed, nil after Shutdown.
+func (r *Proxy) Err() error {
+	select {
+	case <-r.done:
+		return r.err
+	default:
+		return nil
+	}
+}
+
+// Addr returns the address the proxy listens on, with the chosen port for the port 0.
+// It is nil before Run.
+func (r *Proxy) Addr() net.Addr {
+	return r.addr
+}
+
+// TLSAddr returns the address of the HTTPS listener like Addr, it is nil without the HTTPS listener.
+func (r *Proxy) TLSAddr() net.Addr {
+	return r.tlsAddr
+}
+
+// ClientAddress returns the address of the proxy for the clients in the same process, e.g. the
+// webhook tunnels: http://host:port or unix:/path for a unix socket.
+func (r *Proxy) ClientAddress() string {
+	return clientAddress(r.addr)
+}
+
+// Reload replaces the signer configurations without interrupting the requests in flight.
+func (r *Proxy) Reload(signerConfigs map[string]SignerConfig) ConfigChanges {
+	return r.signerConfigs.Replace(signerConfigs)
+}
@@ -19,10 +19,16 @@ package runtime
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -33,6 +39,7 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/localca"
 	"github.com/upvestco/httpsignature-proxy/service/logger"
 	"github.com/upvestco/httpsignature-proxy/service/signer"
 	"github.com/upvestco/httpsignature-proxy/service/signer/material"
@@ -48,12 +55,8 @@ Z9pVt7ezzsXsTa83aTfeDQjMVkHQFnp7K5V/s4qAElRjSZvKdkGRjvgqAHnz2DYw
 qFs3oIGIa4fr1C7SXmMyCohmJznOH3kGu73fV6GJkdc=
 -----END EC PRIVATE KEY-----`
 
-	testPass    = "123456"
-	testKeyID   = "key_id"
-	testBaseUrl = "http://localhost:3001"
-
-	runtimePort  = 3002
-	verifierPort = 3001
+	testPass  = "123456"
+	testKeyID = "key_id"
 )
 
 func TestRuntime_Run(t *testing.T) {
@@ -64,18 +67,35 @@ type TestProxySuite struct {
 	suite.Suite
 	testServ *testService
 	clientID uuid.UUID
+	tlsDir   string
+	proxy    *Proxy
 }
 
 func (s *TestProxySuite) SetupSuite() {
 	s.clientID = uuid.New()
-	cfg := &config.Config{
-		Port:           runtimePort,
-		DefaultTimeout: 30 * time.Second,
-		PullDelay:      time.Second,
+	s.tlsDir = s.T().TempDir()
+	s.setupTestService()
+	s.proxy = s.setupProxy(s.config("localhost:0"))
+}
+
+func (s *TestProxySuite) TearDownSuite() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.NoError(s.proxy.Shutdown(ctx))
+	s.testServ.Stop()
+}
+
+func (s *TestProxySuite) config(listenAddress string) *config.Config {
+	return &config.Config{
+		ListenAddress:    listenAddress,
+		TLSListenAddress: "localhost:0",
+		TLSDir:           s.tlsDir,
+		DefaultTimeout:   30 * time.Second,
+		PullDelay:        time.Second,
 		KeyConfigs: []config.KeyConfig{
 			{
 				BaseConfig: config.BaseConfig{
-					BaseUrl:            testBaseUrl,
+					BaseUrl:            s.testServ.URL(),
 					PrivateKeyFileName: "",
 					Password:           testPass,
 					KeyID:              testKeyID,
@@ -84,8 +104,6 @@ func (s *TestProxySuite) SetupSuite() {
 			},
 		},
 	}
-	s.setupTestService()
-	s.setupProxy(cfg)
 }
 
 func (s *TestProxySuite) setupTestService() {
@@ -93,7 +111,7 @@ func (s *TestProxySuite) setupTestService() {
 	s.testServ.Start(s.T())
 }
 
-func (s *TestProxySuite) setupProxy(cfg *config.Config) {
+func (s *TestProxySuite) setupProxy(cfg *config.Config) *Proxy {
 	signerConfigs := make(map[string]SignerConfig)
 	for i := range cfg.KeyConfigs {
 		privateSchemeBuilder, err := signer.NewLocalPrivateSchemeBuilderFromSeed(privateTestKey, &cfg.KeyConfigs[i])
@@ -105,11 +123,59 @@ func (s *TestProxySuite) setupProxy(cfg *config.Config) {
 	}
 	r := NewProxy(cfg, signerConfigs, nil, logger.New(false))
 	require.NoError(s.T(), r.Run())
-	time.Sleep(1 * time.Second)
+	return &r
 }
 
 func (s *TestProxySuite) Test_ProxyRun() {
-	url := fmt.Sprintf("http://localhost:%d/%s", runtimePort, "endpoint?param=val")
+	s.checkProxy(&http.Client{}, s.proxy.ClientAddress()+"/endpoint?param=val")
+}
+
+func (s *TestProxySuite) Test_ProxyRunUnixSocket() {
+	path := filepath.Join(s.T().TempDir(), "proxy.sock")
+	cfg := s.config(UnixSocketPrefix + path)
+	cfg.TLSListenAddress = ""
+	cfg.SocketMode = 0o660
+	proxy := s.setupProxy(cfg)
+	assert.Equal(s.T(), UnixSocketPrefix+path, proxy.ClientAddress())
+	info, err := os.Stat(path)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), os.FileMode(0o660), info.Mode().Perm())
+	// the private directory the socket was created in is removed
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(s.T(), err)
+	assert.Len(s.T(), entries, 1)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+	s.checkProxy(client, "http://localhost/endpoint?param=val")
+
+	// a second proxy can not take over the socket in use
+	_, err = listen(UnixSocketPrefix+path, 0)
+	assert.ErrorContains(s.T(), err, "in use")
+
+	s.NoError(proxy.Shutdown(context.Background()))
+	assert.NoFileExists(s.T(), path)
+}
+
+func (s *TestProxySuite) Test_ProxyRunTLS() {
+	ca, err := localca.LoadOrCreate(s.tlsDir)
+	require.NoError(s.T(), err)
+	pool := x509.NewCertPool()
+	require.True(s.T(), pool.AppendCertsFromPEM(ca.CertificatePEM()))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	_, port, err := net.SplitHostPort(s.proxy.TLSAddr().String())
+	require.NoError(s.T(), err)
+	assert.NotEqual(s.T(), "0", port)
+	s.checkProxy(client, fmt.Sprintf("https://localhost:%s/%s", port, "endpoint?param=val"))
+	s.checkProxy(client, fmt.Sprintf("https://127.0.0.1:%s/%s", port, "endpoint?param=val"))
+}
+
+func (s *TestProxySuite) checkProxy(client *http.Client, url string) {
 	pl := []byte("This is the body")
 	body := bytes.NewBuffer(pl)
 
@@ -119,7 +185,6 @@ func (s *TestProxySuite) Test_ProxyRun() {
 	param := req.URL.Query().Get("param")
 	require.NotEmpty(s.T(), param)
 
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	require.NoError(s.T(), err)
 	defer func() {
@@ -132,7 +197,12 @@ func (s *TestProxySuite) Test_ProxyRun() {
 }
 
 type testService struct {
-	server *http.Server
+	server   *http.Server
+	listener net.Listener
+}
+
+func (s *testService) URL() string {
+	return "http://" + s.listener.Addr().String()
 }
 
 func (s *testService) Stop() {
@@ -147,13 +217,15 @@ func (s *testService) Start(t *testing.T) {
 
 	h := &handler{router: router, t: t}
 
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	s.listener = listener
 	s.server = &http.Server{
-		Addr:    fmt.Sprintf("0.0.0.0:%d", verifierPort),
 		Handler: h,
 	}
 
 	go func() {
-		if err := s.server.ListenAndServe(); err != nil {
+		if err := s.server.Serve(listener); err != nil {
 			if err.Error() != http.ErrServerClosed.Error() {
 				log.Fatal(err)
 			}
@@ -195,3 +267,83 @@ func (e *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	r.Body = io.NopCloser(bytes.NewReader(body))
 	e.router.ServeHTTP(w, r)
 }
+
+func TestProxy_Shutdown(t *testing.T) {
+	received := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		time.Sleep(300 * time.Millisecond)
+		_, _ = w.Write([]byte("done"))
+	}))
+	defer backend.Close()
+
+	h, clientID := newTestHandler(t, backend.URL, nil)
+	path := filepath.Join(t.TempDir(), "proxy.sock")
+	cfg := &config.Config{ListenAddress: UnixSocketPrefix + path, DefaultTimeout: 30 * time.Second}
+	proxy := NewProxy(cfg, h.signerConfigs.All(), nil, logger.New(false))
+	require.NoError(t, proxy.Run())
+	<-proxy.Ready()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	results := make(chan result, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost/endpoint", nil)
+		req.Header.Set(upvestClientID, clientID.String())
+		resp, err := client.Do(req)
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		body, err := io.ReadAll(resp.Body)
+		results <- result{status: resp.StatusCode, body: string(body), err: err}
+	}()
+
+	<-received
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, proxy.Shutdown(ctx))
+
+	// the request in flight is drained
+	res := <-results
+	require.NoError(t, res.err)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "done", res.body)
+
+	select {
+	case <-proxy.Done():
+	default:
+		t.Fatal("Done is not closed after Shutdown")
+	}
+	assert.NoError(t, proxy.Err())
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "the unix socket is removed")
+}
+
+func TestTLSListenAddress(t *testing.T) {
+	tests := []struct {
+		cfg      config.Config
+		expected string
+	}{
+		{cfg: config.Config{Port: 3000}, expected: ""},
+		{cfg: config.Config{TLSPort: 3443}, expected: "localhost:3443"},
+		{cfg: config.Config{ListenAddress: "0.0.0.0:3000", TLSPort: 3443}, expected: "0.0.0.0:3443"},
+		{cfg: config.Config{ListenAddress: "unix:/run/proxy.sock", TLSPort: 3443}, expected: "localhost:3443"},
+		{cfg: config.Config{ListenAddress: "0.0.0.0:3000", TLSPort: 3443, TLSListenAddress: "localhost:0"}, expected: "localhost:0"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, tlsListenAddress(&tt.cfg), "%+v", tt.cfg)
+	}
+}
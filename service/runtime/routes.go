@@ -0,0 +1,139 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/upvestco/httpsignature-proxy/config"
+)
+
+// ErrHostNotCovered rejects a forward proxy request to a host which is not the host of a base URL
+// of the key config selected by the client ID, its key must not be sent there.
+var ErrHostNotCovered = errors.New("the host is not a base URL host of the key config")
+
+// upstream is where a request is sent to.
+type upstream struct {
+	url     *url.URL
+	timeout time.Duration
+	// route is the matching route, nil for the base URL of the key config.
+	route *config.Route
+}
+
+// selectUpstream returns the upstream of the first route matching the request, or the base URL
+// of the key config. A forward proxy request is matched with the host it was sent to, which has to
+// be a base URL host of the key config, and is sent with the scheme of that base URL.
+func selectUpstream(keyConfig config.BaseConfig, inReq *http.Request, defaultTimeout time.Duration) (upstream, error) {
+	res := upstream{timeout: defaultTimeout}
+	baseUrl := keyConfig.BaseUrl
+	host := inReq.Host
+	if inReq.URL.IsAbs() {
+		host = inReq.URL.Host
+		if baseUrl = coveringBaseUrl(keyConfig, host); baseUrl == "" {
+			return upstream{}, errors.WithMessage(ErrHostNotCovered, host)
+		}
+	}
+	path := inReq.URL.Path
+	for i := range keyConfig.Routes {
+		route := &keyConfig.Routes[i]
+		if !matchRoute(route, host, inReq) {
+			continue
+		}
+		res.route, baseUrl = route, route.BaseUrl
+		if route.Timeout > 0 {
+			res.timeout = route.Timeout
+		}
+		if route.RewritePathPrefix != "" {
+			path = route.RewritePathPrefix + strings.TrimPrefix(path, route.PathPrefix)
+		}
+		break
+	}
+
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return upstream{}, errors.Wrap(err, "Wrong base URL")
+	}
+	u.Path = path
+	u.RawQuery = inReq.URL.RawQuery
+	res.url = u
+	return res, nil
+}
+
+// coveringBaseUrl returns the base URL of the key config or of its routes with the host, empty
+// when there is none.
+func coveringBaseUrl(keyConfig config.BaseConfig, host string) string {
+	baseUrls := []string{keyConfig.BaseUrl}
+	for _, route := range keyConfig.Routes {
+		baseUrls = append(baseUrls, route.BaseUrl)
+	}
+	for _, baseUrl := range baseUrls {
+		if u, err := url.Parse(baseUrl); err == nil && coversHost(u, host) {
+			return baseUrl
+		}
+	}
+	return ""
+}
+
+// coversHost compares the host names and the ports, a host without a port matches the base URL
+// with any port, e.g. the plain http request to an https base URL.
+func coversHost(baseUrl *url.URL, host string) bool {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		return strings.EqualFold(baseUrl.Hostname(), host)
+	}
+	return strings.EqualFold(withPort(baseUrl.Host, baseUrl.Scheme), host)
+}
+
+// matchRoute matches the request with the host it was sent to.
+func matchRoute(route *config.Route, host string, req *http.Request) bool {
+	if route.PathPrefix != "" && !hasPathPrefix(req.URL.Path, route.PathPrefix) {
+		return false
+	}
+	if route.Host != "" && !matchHost(route.Host, host) {
+		return false
+	}
+	if route.Header != "" {
+		values := req.Header.Values(route.Header)
+		if len(values) == 0 || (route.HeaderValue != "" && !strings.EqualFold(strings.TrimSpace(values[0]), route.HeaderValue)) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasPathPrefix matches whole path segments, /auth matches /auth and /auth/token but not /author.
+func hasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// matchHost compares the host with the port only when the route host has one.
+func matchHost(routeHost, host string) bool {
+	if _, _, err := net.SplitHostPort(routeHost); err != nil {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+	return strings.EqualFold(routeHost, host)
+}
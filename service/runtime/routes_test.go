@@ -0,0 +1,141 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/signer/material"
+)
+
+func TestHandler_Routes(t *testing.T) {
+	type received struct {
+		backend, path, target, signature string
+	}
+	var last received
+	backend := func(name string, delay time.Duration) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			last = received{backend: name, path: r.URL.Path, target: r.Header.Get("X-Proxy-Target"), signature: r.Header.Get(material.SignatureHeader)}
+		}))
+	}
+	api, auth, staging, slow := backend("api", 0), backend("auth", 0), backend("staging", 0), backend("slow", 500*time.Millisecond)
+	for _, s := range []*httptest.Server{api, auth, staging, slow} {
+		defer s.Close()
+	}
+
+	routes := []config.Route{
+		{PathPrefix: "/auth", BaseUrl: auth.URL},
+		{Header: "X-Proxy-Target", HeaderValue: "staging", BaseUrl: staging.URL},
+		{Host: "staging.localhost", PathPrefix: "/v2", RewritePathPrefix: "/api/v2", BaseUrl: staging.URL},
+		{PathPrefix: "/reports", Timeout: 100 * time.Millisecond, BaseUrl: slow.URL},
+	}
+	for i := range routes {
+		assert.NoError(t, routes[i].Validate())
+	}
+	h, clientID := newTestHandlerWithConfig(t, nil, privateTestKey, config.BaseConfig{
+		BaseUrl:  api.URL,
+		Password: testPass,
+		KeyID:    testKeyID,
+		Routes:   routes,
+	})
+
+	tests := []struct {
+		name, host, path, target string
+		code                     int
+		expected                 received
+	}{
+		{name: "base url", path: "/accounts", code: http.StatusOK, expected: received{backend: "api", path: "/accounts"}},
+		{name: "path prefix", path: "/auth/keys", code: http.StatusOK, expected: received{backend: "auth", path: "/auth/keys"}},
+		{name: "path segments", path: "/authors", code: http.StatusOK, expected: received{backend: "api", path: "/authors"}},
+		{name: "header", path: "/accounts", target: "Staging", code: http.StatusOK, expected: received{backend: "staging", path: "/accounts"}},
+		{name: "other header value", path: "/accounts", target: "sandbox", code: http.StatusOK, expected: received{backend: "api", path: "/accounts", target: "sandbox"}},
+		{name: "host and rewrite", host: "staging.localhost:3000", path: "/v2/orders", code: http.StatusOK, expected: received{backend: "staging", path: "/api/v2/orders"}},
+		{name: "timeout", path: "/reports/1", code: http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			last = received{}
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			req.Header.Set(upvestClientID, clientID.String())
+			if tt.target != "" {
+				req.Header.Set("X-Proxy-Target", tt.target)
+			}
+			rec := httptest.NewRecorder()
+
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.code, rec.Code)
+			if tt.code != http.StatusOK {
+				return
+			}
+			assert.NotEmpty(t, last.signature)
+			last.signature = ""
+			assert.Equal(t, tt.expected, last)
+		})
+	}
+
+	invalid := []config.Route{
+		{BaseUrl: api.URL},
+		{PathPrefix: "auth", BaseUrl: api.URL},
+		{HeaderValue: "staging", PathPrefix: "/", BaseUrl: api.URL},
+		{Host: "staging.localhost", RewritePathPrefix: "/api", BaseUrl: api.URL},
+		{PathPrefix: "/auth", BaseUrl: "auth"},
+	}
+	for _, route := range invalid {
+		assert.Error(t, route.Validate(), route.String())
+	}
+}
+
+func TestSelectUpstream_ForwardProxy(t *testing.T) {
+	keyConfig := config.BaseConfig{
+		BaseUrl: "https://api.example.com",
+		Routes:  []config.Route{{PathPrefix: "/auth", Timeout: time.Second, BaseUrl: "https://auth.example.com"}},
+	}
+	tests := []struct {
+		url, expected string
+		timeout       time.Duration
+	}{
+		{url: "https://api.example.com:443/accounts", expected: "https://api.example.com/accounts", timeout: time.Minute},
+		{url: "http://api.example.com/accounts?a=1", expected: "https://api.example.com/accounts?a=1", timeout: time.Minute},
+		{url: "https://auth.example.com:443/token", expected: "https://auth.example.com/token", timeout: time.Minute},
+		{url: "https://api.example.com:443/auth/token", expected: "https://auth.example.com/auth/token", timeout: time.Second},
+		{url: "https://other.example.com:443/accounts"},
+		{url: "https://api.example.com:8443/accounts"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		target, err := selectUpstream(keyConfig, req, time.Minute)
+		if tt.expected == "" {
+			assert.ErrorIs(t, err, ErrHostNotCovered, tt.url)
+			continue
+		}
+		if assert.NoError(t, err, tt.url) {
+			assert.Equal(t, tt.expected, target.url.String())
+			assert.Equal(t, tt.timeout, target.timeout, tt.url)
+		}
+	}
+}
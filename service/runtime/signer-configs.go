@@ -0,0 +1,161 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
+)
+
+// SignerConfigs holds the signer configurations by clientID. A reload replaces them
+// atomically, the requests in flight finish with the configuration they started with.
+type SignerConfigs struct {
+	configs atomic.Pointer[map[string]SignerConfig]
+}
+
+func NewSignerConfigs(configs map[string]SignerConfig) *SignerConfigs {
+	s := &SignerConfigs{}
+	s.configs.Store(&configs)
+	return s
+}
+
+func (s *SignerConfigs) Get(clientID string) (SignerConfig, bool) {
+	signerCfg, ok := (*s.configs.Load())[clientID]
+	return signerCfg, ok
+}
+
+// All returns the current signer configurations, the map must not be modified.
+func (s *SignerConfigs) All() map[string]SignerConfig {
+	return *s.configs.Load()
+}
+
+// Replace swaps in the new signer configurations and returns the clients which have changed.
+func (s *SignerConfigs) Replace(configs map[string]SignerConfig) ConfigChanges {
+	old := s.configs.Swap(&configs)
+	return diffSignerConfigs(*old, configs)
+}
+
+// ConfigChanges lists the clientIDs added, removed and changed by a reload.
+type ConfigChanges struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+func (c ConfigChanges) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+func (c ConfigChanges) String() string {
+	if c.Empty() {
+		return "no changes"
+	}
+	parts := make([]string, 0, 3)
+	if len(c.Added) > 0 {
+		parts = append(parts, "added "+strings.Join(c.Added, ", "))
+	}
+	if len(c.Removed) > 0 {
+		parts = append(parts, "removed "+strings.Join(c.Removed, ", "))
+	}
+	if len(c.Changed) > 0 {
+		parts = append(parts, "changed "+strings.Join(c.Changed, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func diffSignerConfigs(old, new map[string]SignerConfig) ConfigChanges {
+	var res ConfigChanges
+	for clientID, newCfg := range new {
+		oldCfg, ok := old[clientID]
+		switch {
+		case !ok:
+			res.Added = append(res.Added, clientID)
+		case !sameSignerConfig(oldCfg, newCfg):
+			res.Changed = append(res.Changed, clientID)
+		}
+	}
+	for clientID := range old {
+		if _, ok := new[clientID]; !ok {
+			res.Removed = append(res.Removed, clientID)
+		}
+	}
+	sort.Strings(res.Added)
+	sort.Strings(res.Removed)
+	sort.Strings(res.Changed)
+	return res
+}
+
+// sameSignerConfig compares the key configs and the keys, so a replaced key file counts
+// as a change even when the configuration is the same.
+func sameSignerConfig(a, b SignerConfig) bool {
+	ak, bk := a.KeyConfig, b.KeyConfig
+	if ak.AutoClockOffset && bk.AutoClockOffset {
+		// the detected offset is not a configuration change
+		ak.ClockOffset, bk.ClockOffset = 0, 0
+	}
+	if !reflect.DeepEqual(ak, bk) {
+		return false
+	}
+	if !sameSigns(a.SignBuilder.GetDefaultPrivateKey(), b.SignBuilder.GetDefaultPrivateKey()) {
+		return false
+	}
+	if (a.WebhookVerifier == nil) != (b.WebhookVerifier == nil) {
+		return false
+	}
+	return a.WebhookVerifier == nil || samePublicKey(a.WebhookVerifier.Pub, b.WebhookVerifier.Pub)
+}
+
+func sameSigns(a, b *schema.Sign) bool {
+	if a.KeyID != b.KeyID || a.Algo != b.Algo || len(a.Next) != len(b.Next) {
+		return false
+	}
+	if a.Pub != nil || b.Pub != nil {
+		if !samePublicKey(a.Pub, b.Pub) {
+			return false
+		}
+	} else if pk, ok := privateKey(a.Pk).(interface{ Equal(crypto.PrivateKey) bool }); ok && !pk.Equal(privateKey(b.Pk)) {
+		return false
+	}
+	for i := range a.Next {
+		if !sameSigns(a.Next[i], b.Next[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func samePublicKey(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	pub, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pub.Equal(b)
+}
+
+// privateKey dereferences the ed25519 key which the local signer keeps as a pointer.
+func privateKey(pk interface{}) interface{} {
+	if p, ok := pk.(*ed25519.PrivateKey); ok && p != nil {
+		return *p
+	}
+	return pk
+}
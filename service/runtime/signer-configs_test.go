@@ -0,0 +1,67 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/signer"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSignerConfigs_Replace(t *testing.T) {
+	newSignerConfig := func(keyData string, baseUrl string) SignerConfig {
+		keyCfg := config.KeyConfig{BaseConfig: config.BaseConfig{BaseUrl: baseUrl, KeyID: testKeyID, Password: testPass}}
+		builder, err := signer.NewLocalPrivateSchemeBuilderFromSeed(keyData, &keyCfg)
+		require.NoError(t, err)
+		return SignerConfig{SignBuilder: builder, KeyConfig: keyCfg.BaseConfig}
+	}
+	_, pk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(pk, "", []byte(testPass))
+	require.NoError(t, err)
+	rotatedKey := string(pem.EncodeToMemory(block))
+
+	configs := NewSignerConfigs(map[string]SignerConfig{
+		"same":    newSignerConfig(privateTestKey, "https://a.example"),
+		"url":     newSignerConfig(privateTestKey, "https://a.example"),
+		"key":     newSignerConfig(privateTestKey, "https://a.example"),
+		"removed": newSignerConfig(privateTestKey, "https://a.example"),
+	})
+	changes := configs.Replace(map[string]SignerConfig{
+		"same":  newSignerConfig(privateTestKey, "https://a.example"),
+		"url":   newSignerConfig(privateTestKey, "https://b.example"),
+		"key":   newSignerConfig(rotatedKey, "https://a.example"),
+		"added": newSignerConfig(privateTestKey, "https://a.example"),
+	})
+	assert.Equal(t, ConfigChanges{Added: []string{"added"}, Removed: []string{"removed"}, Changed: []string{"key", "url"}}, changes)
+	assert.Equal(t, "added added; removed removed; changed key, url", changes.String())
+
+	signerCfg, ok := configs.Get("url")
+	require.True(t, ok)
+	assert.Equal(t, "https://b.example", signerCfg.KeyConfig.BaseUrl)
+	_, ok = configs.Get("removed")
+	assert.False(t, ok)
+
+	assert.True(t, configs.Replace(configs.All()).Empty())
+}
@@ -0,0 +1,177 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
+)
+
+const sshAuthSockEnv = "SSH_AUTH_SOCK"
+
+var (
+	ErrAgentKeyNotFound = errors.New("ssh-agent has no key with the fingerprint")
+	errNoAgentSocket    = errors.New("ssh-agent socket is not configured and " + sshAuthSockEnv + " is empty")
+)
+
+// AgentDialer connects to the ssh-agent, the returned function closes the connection.
+type AgentDialer func() (agent.Agent, func(), error)
+
+// SocketAgentDialer connects to the ssh-agent listening on the unix socket, the empty
+// socket selects the one of the SSH_AUTH_SOCK environment variable.
+func SocketAgentDialer(socket string) AgentDialer {
+	return func() (agent.Agent, func(), error) {
+		if socket == "" {
+			socket = os.Getenv(sshAuthSockEnv)
+		}
+		if socket == "" {
+			return nil, nil, errNoAgentSocket
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "dial ssh-agent")
+		}
+		return agent.NewClient(conn), func() { _ = conn.Close() }, nil
+	}
+}
+
+// AgentSchemeBuilder signs through a running ssh-agent, so the private key never
+// lives in the proxy memory or configuration.
+type AgentSchemeBuilder struct {
+	sign *schema.Sign
+}
+
+func NewAgentSchemeBuilder(cfg *config.BaseConfig) (*AgentSchemeBuilder, error) {
+	return NewAgentSchemeBuilderWithDialer(SocketAgentDialer(cfg.AgentSocket), cfg)
+}
+
+func NewAgentSchemeBuilderWithDialer(dial AgentDialer, cfg *config.BaseConfig) (*AgentSchemeBuilder, error) {
+	opts, err := NewMaterialOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newAgentSign(dial, cfg.AgentKeyFingerprint, cfg.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	s.Options = opts
+	for _, key := range cfg.NextKeys {
+		next, err := newNextSign(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "next key %s", key.KeyID)
+		}
+		s.Next = append(s.Next, next)
+	}
+	return &AgentSchemeBuilder{sign: s}, nil
+}
+
+func (b *AgentSchemeBuilder) GetDefaultPrivateKey() *schema.Sign {
+	return b.sign
+}
+
+func newAgentSign(dial AgentDialer, fingerprint, keyID string) (*schema.Sign, error) {
+	a, closeAgent, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	defer closeAgent()
+	keys, err := a.List()
+	if err != nil {
+		return nil, errors.Wrap(err, "list ssh-agent keys")
+	}
+	for _, key := range keys {
+		if !matchFingerprint(key, fingerprint) {
+			continue
+		}
+		pub, err := ssh.ParsePublicKey(key.Marshal())
+		if err != nil {
+			return nil, errors.Wrap(err, "parse ssh-agent key")
+		}
+		cryptoPub, ok := pub.(ssh.CryptoPublicKey)
+		if !ok {
+			return nil, errors.New("unsupported ssh-agent key")
+		}
+		signer := &agentSigner{dial: dial, pub: pub}
+		switch pub := cryptoPub.CryptoPublicKey().(type) {
+		case *ecdsa.PublicKey:
+			// the agent hashes the message by the curve size, only P-521 uses sha-512 as the local signer does
+			if pub.Curve != elliptic.P521() {
+				return nil, errors.Errorf("ssh-agent key %s: only P-521 ecdsa keys are supported, the signatures use sha-512", fingerprint)
+			}
+			signer.ecdsa = true
+			return &schema.Sign{KeyID: keyID, Algo: schema.AlgoECDSA, Pk: signer, Pub: pub}, nil
+		case ed25519.PublicKey:
+			return &schema.Sign{KeyID: keyID, Algo: schema.AlgoEd25519, Pk: signer, Pub: pub}, nil
+		}
+		return nil, errors.Errorf("ssh-agent key %s is neither ecdsa nor ed25519 key", fingerprint)
+	}
+	return nil, errors.WithMessage(ErrAgentKeyNotFound, fingerprint)
+}
+
+// matchFingerprint accepts the SHA256 fingerprint (with or without the "SHA256:" prefix)
+// and the legacy MD5 fingerprint.
+func matchFingerprint(key ssh.PublicKey, fingerprint string) bool {
+	fingerprint = strings.TrimSpace(fingerprint)
+	sha := ssh.FingerprintSHA256(key)
+	return fingerprint == sha || "SHA256:"+fingerprint == sha ||
+		strings.TrimPrefix(fingerprint, "MD5:") == ssh.FingerprintLegacyMD5(key)
+}
+
+// agentSigner implements schema.MessageSigner, it connects to the agent for every
+// signature, so the proxy survives the agent restarts.
+type agentSigner struct {
+	dial  AgentDialer
+	pub   ssh.PublicKey
+	ecdsa bool
+}
+
+func (s *agentSigner) SignMessage(message []byte) ([]byte, error) {
+	a, closeAgent, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer closeAgent()
+	sig, err := a.Sign(s.pub, message)
+	if err != nil {
+		return nil, errors.Wrap(err, "ssh-agent sign")
+	}
+	if !s.ecdsa {
+		return sig.Blob, nil
+	}
+	// the ssh ecdsa signature blob holds r and s as mpints, the proxy sends them ASN.1 encoded
+	var rs struct {
+		R *big.Int
+		S *big.Int
+	}
+	if err := ssh.Unmarshal(sig.Blob, &rs); err != nil {
+		return nil, errors.Wrap(err, "ssh-agent ecdsa signature")
+	}
+	return asn1.Marshal(rs)
+}
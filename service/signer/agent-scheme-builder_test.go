@@ -0,0 +1,90 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/logger"
+	"github.com/upvestco/httpsignature-proxy/service/signer/request"
+	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
+)
+
+func TestAgentSchemeBuilder(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	p521Key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	require.NoError(t, err)
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	keyring := agent.NewKeyring()
+	dial := func() (agent.Agent, func(), error) { return keyring, func() {}, nil }
+
+	tests := []struct {
+		name        string
+		key         interface{}
+		expectedErr string
+	}{
+		{name: "ed25519", key: edKey},
+		{name: "ecdsa P-521", key: p521Key},
+		{name: "ecdsa P-256", key: p256Key, expectedErr: "only P-521"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: tt.key}))
+			sshSigner, err := ssh.NewSignerFromKey(tt.key)
+			require.NoError(t, err)
+
+			b, err := NewAgentSchemeBuilderWithDialer(dial, &config.BaseConfig{
+				KeyID:               "agent_key",
+				AgentKeyFingerprint: ssh.FingerprintSHA256(sshSigner.PublicKey()),
+			})
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			sign := b.GetDefaultPrivateKey()
+
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/endpoint", bytes.NewBufferString(`{"a":1}`))
+			require.NoError(t, err)
+			require.NoError(t, request.New(logger.New(false)).Sign(req, sign))
+
+			verifier := &schema.Verifier{Algo: sign.Algo, Pub: sign.Pub}
+			reports, err := verifier.VerifyRequest(req)
+			require.NoError(t, err)
+			require.Len(t, reports, 1)
+			assert.True(t, reports[0].Valid(), reports[0].SignatureError)
+		})
+	}
+
+	_, err = NewAgentSchemeBuilderWithDialer(dial, &config.BaseConfig{KeyID: "agent_key", AgentKeyFingerprint: "SHA256:unknown"})
+	assert.ErrorIs(t, err, ErrAgentKeyNotFound)
+}
@@ -0,0 +1,55 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrNoDateHeader = errors.New("response has no valid Date header")
+
+// DetectClockOffset estimates the offset of the server clock from the Date header of a HEAD request to the base url.
+func DetectClockOffset(ctx context.Context, client *http.Client, baseUrl string) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, baseUrl, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "NewRequestWithContext")
+	}
+	sent := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "Do")
+	}
+	_ = resp.Body.Close()
+	return ClockOffset(resp.Header, sent, time.Now())
+}
+
+// ClockOffset returns the offset of the server clock from the Date header of the response
+// received between sent and received. The Date header is truncated to seconds, so the
+// server time is taken from the middle of the second. The server sets the Date header at
+// an unknown time of the exchange, so the offset is only precise to half of the round trip.
+func ClockOffset(headers http.Header, sent, received time.Time) (time.Duration, error) {
+	date, err := http.ParseTime(headers.Get("Date"))
+	if err != nil {
+		return 0, ErrNoDateHeader
+	}
+	local := sent.Add(received.Sub(sent) / 2)
+	return date.Add(time.Second / 2).Sub(local).Round(time.Second), nil
+}
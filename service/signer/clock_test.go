@@ -0,0 +1,44 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectClockOffset(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-90*time.Second).UTC().Format(http.TimeFormat))
+	}))
+	defer server.Close()
+
+	offset, err := DetectClockOffset(context.Background(), server.Client(), server.URL)
+	require.NoError(t, err)
+	assert.InDelta(t, (-90 * time.Second).Seconds(), offset.Seconds(), 1)
+}
+
+func TestClockOffset_NoDate(t *testing.T) {
+	_, err := ClockOffset(http.Header{}, time.Now(), time.Now())
+	assert.ErrorIs(t, err, ErrNoDateHeader)
+}
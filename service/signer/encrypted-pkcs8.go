@@ -0,0 +1,267 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"hash"
+
+	"github.com/pkg/errors"
+)
+
+/*
+Encryption and decryption of PBES2 encrypted PKCS#8 keys, see https://datatracker.ietf.org/doc/html/rfc8018
+and https://datatracker.ietf.org/doc/html/rfc5958 */
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidAES128GCM = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 6}
+	oidAES192GCM = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 26}
+	oidAES256GCM = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 46}
+)
+
+// pbkdf2Iterations is the PBKDF2 work factor of the generated keys, as recommended by OWASP for HMAC-SHA256.
+const pbkdf2Iterations = 600000
+
+// maxPBKDF2Iterations bounds the work factor of a key file, a larger one would block the startup
+// and every reload.
+const maxPBKDF2Iterations = 10000000
+
+var (
+	ErrUnsupportedEncryption = errors.New("unsupported private key encryption")
+	ErrDecryptionFailed      = errors.New("private key decryption failed, check the password")
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+type gcmParams struct {
+	Nonce  []byte
+	ICVLen int `asn1:"optional,default:12"`
+}
+
+type aesScheme struct {
+	keyLen int
+	gcm    bool
+}
+
+var aesSchemes = map[string]aesScheme{
+	oidAES128CBC.String(): {keyLen: 16},
+	oidAES192CBC.String(): {keyLen: 24},
+	oidAES256CBC.String(): {keyLen: 32},
+	oidAES128GCM.String(): {keyLen: 16, gcm: true},
+	oidAES192GCM.String(): {keyLen: 24, gcm: true},
+	oidAES256GCM.String(): {keyLen: 32, gcm: true},
+}
+
+var prfs = map[string]func() hash.Hash{
+	oidHMACWithSHA1.String():   sha1.New,
+	oidHMACWithSHA224.String(): sha256.New224,
+	oidHMACWithSHA256.String(): sha256.New,
+	oidHMACWithSHA384.String(): sha512.New384,
+	oidHMACWithSHA512.String(): sha512.New,
+}
+
+// parseEncryptedPKCS8PrivateKey decrypts an "ENCRYPTED PRIVATE KEY" block body and parses the inner PKCS#8 key.
+func parseEncryptedPKCS8PrivateKey(der []byte, password []byte) (interface{}, error) {
+	plain, err := decryptPKCS8(der, password)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := x509.ParsePKCS8PrivateKey(plain)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return pk, nil
+}
+
+// encryptPKCS8 encrypts the PKCS#8 key with AES-256-CBC and a PBKDF2-HMAC-SHA256 derived key,
+// the scheme of "openssl genpkey -aes256".
+func encryptPKCS8(plain []byte, password []byte) ([]byte, error) {
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "salt")
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, errors.Wrap(err, "iv")
+	}
+	key, err := pbkdf2.Key(sha256.New, string(password), salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "PBKDF2")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "NewCipher")
+	}
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	data := append(append([]byte(nil), plain...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{Salt: salt, IterationCount: pbkdf2Iterations,
+		PRF: pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue}})
+	if err != nil {
+		return nil, errors.Wrap(err, "PBKDF2 params")
+	}
+	encParams, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, errors.Wrap(err, "CBC params")
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: encParams}},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "PBES2 params")
+	}
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: data,
+	})
+}
+
+func decryptPKCS8(der []byte, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, errors.Wrap(err, "EncryptedPrivateKeyInfo")
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errors.WithMessage(ErrUnsupportedEncryption, info.Algorithm.Algorithm.String())
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.Wrap(err, "PBES2 params")
+	}
+
+	scheme, ok := aesSchemes[params.EncryptionScheme.Algorithm.String()]
+	if !ok {
+		return nil, errors.WithMessage(ErrUnsupportedEncryption, params.EncryptionScheme.Algorithm.String())
+	}
+	key, err := deriveKey(params.KeyDerivationFunc, password, scheme.keyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "NewCipher")
+	}
+	if scheme.gcm {
+		return decryptGCM(block, params.EncryptionScheme.Parameters.FullBytes, info.EncryptedData)
+	}
+	return decryptCBC(block, params.EncryptionScheme.Parameters.FullBytes, info.EncryptedData)
+}
+
+func deriveKey(kdf pkix.AlgorithmIdentifier, password []byte, keyLen int) ([]byte, error) {
+	if !kdf.Algorithm.Equal(oidPBKDF2) {
+		return nil, errors.WithMessage(ErrUnsupportedEncryption, kdf.Algorithm.String())
+	}
+	var params pbkdf2Params
+	if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.Wrap(err, "PBKDF2 params")
+	}
+	if params.IterationCount < 1 || params.IterationCount > maxPBKDF2Iterations {
+		return nil, errors.WithMessagef(ErrUnsupportedEncryption, "PBKDF2 iteration count %d, expected 1 to %d", params.IterationCount, maxPBKDF2Iterations)
+	}
+	if params.KeyLength != 0 && params.KeyLength != keyLen {
+		return nil, errors.WithMessagef(ErrUnsupportedEncryption, "PBKDF2 key length %d for a cipher key of %d bytes", params.KeyLength, keyLen)
+	}
+	prf := sha1.New
+	if len(params.PRF.Algorithm) > 0 {
+		var ok bool
+		if prf, ok = prfs[params.PRF.Algorithm.String()]; !ok {
+			return nil, errors.WithMessage(ErrUnsupportedEncryption, params.PRF.Algorithm.String())
+		}
+	}
+	return pbkdf2.Key(prf, string(password), params.Salt, params.IterationCount, keyLen)
+}
+
+func decryptCBC(block cipher.Block, rawParams []byte, data []byte) ([]byte, error) {
+	var iv []byte
+	if _, err := asn1.Unmarshal(rawParams, &iv); err != nil {
+		return nil, errors.Wrap(err, "CBC params")
+	}
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, ErrDecryptionFailed
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, ErrDecryptionFailed
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, ErrDecryptionFailed
+		}
+	}
+	return plain[:len(plain)-padding], nil
+}
+
+func decryptGCM(block cipher.Block, rawParams []byte, data []byte) ([]byte, error) {
+	var params gcmParams
+	if _, err := asn1.Unmarshal(rawParams, &params); err != nil {
+		return nil, errors.Wrap(err, "GCM params")
+	}
+	aead, err := cipher.NewGCMWithNonceSize(block, len(params.Nonce))
+	if err != nil {
+		return nil, errors.Wrap(err, "NewGCM")
+	}
+	if params.ICVLen != aead.Overhead() {
+		return nil, errors.WithMessagef(ErrUnsupportedEncryption, "GCM tag length %d", params.ICVLen)
+	}
+	plain, err := aead.Open(nil, params.Nonce, data, nil)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plain, nil
+}
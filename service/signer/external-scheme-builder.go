@@ -0,0 +1,198 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/asn1"
+	"encoding/json"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
+)
+
+/*
+The external signer protocol: the proxy sends one PluginRequest as a JSON line and reads
+one PluginResponse as a JSON line. A command gets the request on stdin and writes the
+response to stdout, a unix socket service gets a new connection for every request. */
+
+const DefaultPluginTimeout = 10 * time.Second
+
+var ErrPluginSigning = errors.New("external signer failed")
+
+// PluginRequest asks the external signer to sign the message, the signature base of the request.
+type PluginRequest struct {
+	KeyID   string `json:"key_id"`
+	Message []byte `json:"message"`
+}
+
+// PluginResponse returns the signature bytes and the algorithm: "ECDSA" for the ASN.1 encoded
+// signature of the sha-512 hash of the message or "Ed25519". Error reports a failed signing.
+type PluginResponse struct {
+	Signature []byte `json:"signature"`
+	Algorithm string `json:"algorithm"`
+	Error     string `json:"error,omitempty"`
+}
+
+// PluginTransport sends the request to the external signer and returns its response.
+type PluginTransport func(ctx context.Context, req []byte) ([]byte, error)
+
+// CommandTransport runs the command for every signature. The command line runs in the shell like
+// the password command, so the arguments and paths with spaces are quoted.
+func CommandTransport(command string) PluginTransport {
+	return func(ctx context.Context, req []byte) ([]byte, error) {
+		if strings.TrimSpace(command) == "" {
+			return nil, errors.New("signer command is empty")
+		}
+		cmd := shellCommand(ctx, command)
+		cmd.Stdin = bytes.NewReader(req)
+		stderr := new(bytes.Buffer)
+		cmd.Stderr = stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, errors.Wrapf(err, "signer command: %s", strings.TrimSpace(stderr.String()))
+		}
+		return out, nil
+	}
+}
+
+// SocketTransport connects to the unix socket service for every signature.
+func SocketTransport(socket string) PluginTransport {
+	return func(ctx context.Context, req []byte) ([]byte, error) {
+		conn, err := new(net.Dialer).DialContext(ctx, "unix", socket)
+		if err != nil {
+			return nil, errors.Wrap(err, "dial signer socket")
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		if _, err := conn.Write(req); err != nil {
+			return nil, errors.Wrap(err, "write signer socket")
+		}
+		resp, err := bufio.NewReader(conn).ReadBytes('\n')
+		if err != nil && len(resp) == 0 {
+			return nil, errors.Wrap(err, "read signer socket")
+		}
+		return resp, nil
+	}
+}
+
+// ExternalSchemeBuilder signs with an external command or a unix socket service, e.g. a
+// wrapper of Vault transit, a cloud KMS or an HSM gateway.
+type ExternalSchemeBuilder struct {
+	sign *schema.Sign
+}
+
+func NewExternalSchemeBuilder(cfg *config.BaseConfig) (*ExternalSchemeBuilder, error) {
+	transport := SocketTransport(cfg.SignerSocket)
+	if cfg.SignerCommand != "" {
+		transport = CommandTransport(cfg.SignerCommand)
+	}
+	return NewExternalSchemeBuilderWithTransport(transport, cfg)
+}
+
+func NewExternalSchemeBuilderWithTransport(transport PluginTransport, cfg *config.BaseConfig) (*ExternalSchemeBuilder, error) {
+	opts, err := NewMaterialOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SignerAlgorithm != schema.AlgoEd25519 && cfg.SignerAlgorithm != schema.AlgoECDSA {
+		return nil, errors.Errorf("unsupported signer algorithm %q", cfg.SignerAlgorithm)
+	}
+	plugin := &pluginSigner{transport: transport, keyID: cfg.KeyID, algorithm: cfg.SignerAlgorithm, timeout: DefaultPluginTimeout}
+	s := &schema.Sign{KeyID: cfg.KeyID, Algo: cfg.SignerAlgorithm, Pk: plugin, Options: opts}
+	for _, key := range cfg.NextKeys {
+		next, err := newNextSign(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "next key %s", key.KeyID)
+		}
+		s.Next = append(s.Next, next)
+	}
+	return &ExternalSchemeBuilder{sign: s}, nil
+}
+
+func (b *ExternalSchemeBuilder) GetDefaultPrivateKey() *schema.Sign {
+	return b.sign
+}
+
+// pluginSigner implements schema.MessageSigner with the external signer. The signer has to
+// use the configured algorithm, the proxy checks the signature format.
+type pluginSigner struct {
+	transport PluginTransport
+	keyID     string
+	algorithm string
+	timeout   time.Duration
+}
+
+func (p *pluginSigner) SignMessage(message []byte) ([]byte, error) {
+	req, err := json.Marshal(PluginRequest{KeyID: p.keyID, Message: message})
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	out, err := p.transport(ctx, append(req, '\n'))
+	if err != nil {
+		return nil, errors.Wrap(ErrPluginSigning, err.Error())
+	}
+	var resp PluginResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, errors.Wrapf(ErrPluginSigning, "invalid response: %s", err.Error())
+	}
+	if resp.Error != "" {
+		return nil, errors.Wrap(ErrPluginSigning, resp.Error)
+	}
+	if resp.Algorithm != p.algorithm {
+		return nil, errors.Wrapf(ErrPluginSigning, "algorithm %q, expected %q", resp.Algorithm, p.algorithm)
+	}
+	if err := checkSignatureFormat(resp.Algorithm, resp.Signature); err != nil {
+		return nil, errors.Wrap(ErrPluginSigning, err.Error())
+	}
+	return resp.Signature, nil
+}
+
+func checkSignatureFormat(algorithm string, signature []byte) error {
+	switch algorithm {
+	case schema.AlgoEd25519:
+		if len(signature) != ed25519.SignatureSize {
+			return errors.Errorf("ed25519 signature has %d bytes", len(signature))
+		}
+	case schema.AlgoECDSA:
+		var rs struct {
+			R *big.Int
+			S *big.Int
+		}
+		if rest, err := asn1.Unmarshal(signature, &rs); err != nil || len(rest) > 0 {
+			return errors.New("ecdsa signature is not ASN.1 encoded")
+		}
+	default:
+		return errors.Errorf("unsupported algorithm %q", algorithm)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/logger"
+	"github.com/upvestco/httpsignature-proxy/service/signer/request"
+	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
+)
+
+const stubSignerSeedEnv = "HTTPSIGNATURE_PROXY_STUB_SIGNER_SEED"
+
+// TestStubSigner is the stub executable of the external signer protocol, it is run by
+// the tests below as a separate process and does nothing in a normal test run.
+func TestStubSigner(t *testing.T) {
+	seed := os.Getenv(stubSignerSeedEnv)
+	if seed == "" {
+		return
+	}
+	raw, _ := hex.DecodeString(seed)
+	_ = json.NewEncoder(os.Stdout).Encode(stubSign(ed25519.NewKeyFromSeed(raw), os.Stdin))
+	os.Exit(0)
+}
+
+func stubSign(pk ed25519.PrivateKey, in interface{ Read([]byte) (int, error) }) PluginResponse {
+	line, err := bufio.NewReader(in).ReadBytes('\n')
+	if err != nil {
+		return PluginResponse{Error: err.Error()}
+	}
+	var req PluginRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return PluginResponse{Error: err.Error()}
+	}
+	if req.KeyID != "plugin_key" {
+		return PluginResponse{Error: "unknown key " + req.KeyID}
+	}
+	return PluginResponse{Algorithm: schema.AlgoEd25519, Signature: ed25519.Sign(pk, req.Message)}
+}
+
+func TestExternalSchemeBuilder(t *testing.T) {
+	pub, pk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	socket := filepath.Join(t.TempDir(), "signer.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = json.NewEncoder(conn).Encode(stubSign(pk, conn))
+			_ = conn.Close()
+		}
+	}()
+
+	t.Setenv(stubSignerSeedEnv, hex.EncodeToString(pk.Seed()))
+	tests := []struct {
+		name string
+		cfg  config.BaseConfig
+	}{
+		{name: "command", cfg: config.BaseConfig{KeyID: "plugin_key", SignerCommand: "'" + os.Args[0] + "' '-test.run=^TestStubSigner$'", SignerAlgorithm: schema.AlgoEd25519}},
+		{name: "socket", cfg: config.BaseConfig{KeyID: "plugin_key", SignerSocket: socket, SignerAlgorithm: schema.AlgoEd25519}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewExternalSchemeBuilder(&tt.cfg)
+			require.NoError(t, err)
+			assert.Equal(t, schema.AlgoEd25519, b.GetDefaultPrivateKey().Algo)
+
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/endpoint", bytes.NewBufferString(`{"a":1}`))
+			require.NoError(t, err)
+			require.NoError(t, request.New(logger.New(false)).Sign(req, b.GetDefaultPrivateKey()))
+
+			reports, err := (&schema.Verifier{Algo: schema.AlgoEd25519, Pub: pub}).VerifyRequest(req)
+			require.NoError(t, err)
+			require.Len(t, reports, 1)
+			assert.True(t, reports[0].Valid(), reports[0].SignatureError)
+		})
+	}
+
+	t.Run("signer error", func(t *testing.T) {
+		b, err := NewExternalSchemeBuilder(&config.BaseConfig{KeyID: "other_key", SignerSocket: socket, SignerAlgorithm: schema.AlgoEd25519})
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodGet, "http://localhost/endpoint", nil)
+		require.NoError(t, err)
+		err = request.New(logger.New(false)).Sign(req, b.GetDefaultPrivateKey())
+		assert.ErrorIs(t, err, ErrPluginSigning)
+		assert.ErrorContains(t, err, "unknown key other_key")
+	})
+
+	t.Run("other algorithm", func(t *testing.T) {
+		b, err := NewExternalSchemeBuilder(&config.BaseConfig{KeyID: "plugin_key", SignerSocket: socket, SignerAlgorithm: schema.AlgoECDSA})
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodGet, "http://localhost/endpoint", nil)
+		require.NoError(t, err)
+		err = request.New(logger.New(false)).Sign(req, b.GetDefaultPrivateKey())
+		assert.ErrorIs(t, err, ErrPluginSigning)
+		assert.ErrorContains(t, err, `algorithm "Ed25519", expected "ECDSA"`)
+	})
+
+	_, err = NewExternalSchemeBuilder(&config.BaseConfig{KeyID: "plugin_key", SignerSocket: socket})
+	assert.ErrorContains(t, err, "unsupported signer algorithm")
+}
@@ -17,12 +17,14 @@ limitations under the License.
 package signer
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/pkg/errors"
 
 	"github.com/upvestco/httpsignature-proxy/service/logger"
 
+	"github.com/upvestco/httpsignature-proxy/service/signer/material"
 	"github.com/upvestco/httpsignature-proxy/service/signer/request"
 )
 
@@ -63,6 +65,9 @@ func (r RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	err := r.signer.Sign(req, r.signingKey)
 	if err != nil {
 		r.log.LogF("signing error: %v", err)
+		if errors.Is(err, material.ErrMissingRequiredComponent) {
+			return nil, fmt.Errorf("%w: %w", ErrSigning, err)
+		}
 		return nil, ErrSigning
 	}
 	origUserAgent := r.inReq.Header.Get("User-Agent")
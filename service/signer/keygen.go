@@ -0,0 +1,91 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+
+	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
+)
+
+const (
+	KeyTypeECDSA   = "ecdsa"
+	KeyTypeEd25519 = "ed25519"
+)
+
+var ErrUnsupportedKeyType = errors.New("unsupported key type")
+
+func KeyTypes() []string {
+	return []string{KeyTypeECDSA, KeyTypeEd25519}
+}
+
+// KeyPair is a generated key pair: the encrypted PKCS#8 PEM private key and the public key
+// in the form Upvest asks for, a PEM "PUBLIC KEY" for ecdsa and the base64 encoded raw key for ed25519.
+type KeyPair struct {
+	PrivateKey []byte
+	PublicKey  []byte
+}
+
+// GenerateKeyPair generates a password protected ecdsa P-256 or ed25519 key pair.
+func GenerateKeyPair(keyType, password string) (*KeyPair, error) {
+	if password == "" {
+		return nil, ErrNoPassword
+	}
+	var pk crypto.Signer
+	var err error
+	switch keyType {
+	case KeyTypeECDSA:
+		pk, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeEd25519:
+		_, pk, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, errors.WithMessage(ErrUnsupportedKeyType, keyType)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "generate key")
+	}
+
+	plain, err := x509.MarshalPKCS8PrivateKey(pk)
+	if err != nil {
+		return nil, errors.Wrap(err, "MarshalPKCS8PrivateKey")
+	}
+	der, err := encryptPKCS8(plain, []byte(password))
+	if err != nil {
+		return nil, errors.Wrap(err, "encrypt private key")
+	}
+	res := &KeyPair{PrivateKey: pem.EncodeToMemory(&pem.Block{Type: schema.EncryptedPkcs8KeyType, Bytes: der})}
+
+	if pub, ok := pk.Public().(ed25519.PublicKey); ok {
+		res.PublicKey = []byte(base64.StdEncoding.EncodeToString(pub) + "\n")
+		return res, nil
+	}
+	pubDer, err := x509.MarshalPKIXPublicKey(pk.Public())
+	if err != nil {
+		return nil, errors.Wrap(err, "MarshalPKIXPublicKey")
+	}
+	res.PublicKey = pem.EncodeToMemory(&pem.Block{Type: publicKeyType, Bytes: pubDer})
+	return res, nil
+}
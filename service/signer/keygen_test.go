@@ -0,0 +1,76 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/logger"
+	"github.com/upvestco/httpsignature-proxy/service/signer/request"
+	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
+)
+
+func TestGenerateKeyPair(t *testing.T) {
+	tests := []struct {
+		keyType  string
+		expected string
+	}{
+		{keyType: KeyTypeECDSA, expected: schema.AlgoECDSA},
+		{keyType: KeyTypeEd25519, expected: schema.AlgoEd25519},
+	}
+	for _, tt := range tests {
+		t.Run(tt.keyType, func(t *testing.T) {
+			pair, err := GenerateKeyPair(tt.keyType, testPass)
+			require.NoError(t, err)
+			assert.Contains(t, string(pair.PrivateKey), schema.EncryptedPkcs8KeyType)
+
+			_, err = createLocalPrivateSchemeBuilder(pair.PrivateKey, testKeyID, "wrong password")
+			assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+			cfg := &config.BaseConfig{KeyID: testKeyID, Password: testPass, PrivateKeyData: string(pair.PrivateKey)}
+			b, err := NewLocalPrivateSchemeBuilder(cfg)
+			require.NoError(t, err)
+			sign := b.GetDefaultPrivateKey()
+			assert.Equal(t, tt.expected, sign.Algo)
+
+			// a request signed by the private key verifies with the public key
+			verifier, err := NewVerifier(pair.PublicKey)
+			require.NoError(t, err)
+			verifier.Options = sign.Options
+			req, err := http.NewRequest(http.MethodPost, "https://example.com/endpoint", strings.NewReader(`{"a":1}`))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			require.NoError(t, request.New(logger.New(false)).Sign(req, sign))
+
+			reports, err := verifier.VerifyRequest(req)
+			require.NoError(t, err)
+			require.Len(t, reports, 1)
+			assert.True(t, reports[0].Valid(), reports[0].Problems())
+		})
+	}
+
+	_, err := GenerateKeyPair("rsa", testPass)
+	assert.ErrorIs(t, err, ErrUnsupportedKeyType)
+	_, err = GenerateKeyPair(KeyTypeEd25519, "")
+	assert.ErrorIs(t, err, ErrNoPassword)
+}
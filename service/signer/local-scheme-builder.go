@@ -18,9 +18,12 @@ package signer
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
@@ -30,15 +33,82 @@ import (
 )
 
 func NewLocalPrivateSchemeBuilder(cfg *config.BaseConfig) (*LocalPrivateSchemeBuilder, error) {
-	body, err := os.ReadFile(cfg.PrivateKeyFileName)
+	body, err := LoadPrivateKeyData(cfg)
 	if err != nil {
 		return nil, err
 	}
-	return createLocalPrivateSchemeBuilder(body, cfg.KeyID, cfg.Password)
+	return newLocalPrivateSchemeBuilder(body, cfg)
+}
+
+// LoadPrivateKeyData returns the PEM private key of the key config from the private key data,
+// the environment variable or the file.
+func LoadPrivateKeyData(cfg *config.BaseConfig) ([]byte, error) {
+	return loadPrivateKeyData(cfg.PrivateKeyFileName, cfg.PrivateKeyData, cfg.PrivateKeyEnv)
+}
+
+// LoadSigningKeyData returns the PEM private key of a next key, like LoadPrivateKeyData.
+func LoadSigningKeyData(key *config.SigningKey) ([]byte, error) {
+	return loadPrivateKeyData(key.PrivateKeyFileName, key.PrivateKeyData, key.PrivateKeyEnv)
+}
+
+func loadPrivateKeyData(fileName, data, env string) ([]byte, error) {
+	switch {
+	case data != "":
+		return decodePrivateKeyData(data)
+	case env != "":
+		res, err := decodePrivateKeyData(os.Getenv(env))
+		return res, errors.Wrapf(err, "private key env %s", env)
+	}
+	return os.ReadFile(fileName)
+}
+
+// decodePrivateKeyData accepts the PEM private key as is or base64 encoded, so it fits in a single line variable.
+func decodePrivateKeyData(data string) ([]byte, error) {
+	data = strings.TrimSpace(data)
+	if strings.HasPrefix(data, "-----BEGIN") {
+		return []byte(data), nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(data), ""))
+	if err != nil {
+		return nil, errors.New("private key data is neither PEM nor base64 encoded PEM")
+	}
+	return decoded, nil
 }
 
 func NewLocalPrivateSchemeBuilderFromSeed(keyData string, cfg *config.KeyConfig) (*LocalPrivateSchemeBuilder, error) {
-	return createLocalPrivateSchemeBuilder([]byte(keyData), cfg.KeyID, cfg.Password)
+	return newLocalPrivateSchemeBuilder([]byte(keyData), &cfg.BaseConfig)
+}
+
+func newLocalPrivateSchemeBuilder(keyData []byte, cfg *config.BaseConfig) (*LocalPrivateSchemeBuilder, error) {
+	opts, err := NewMaterialOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	b, err := createLocalPrivateSchemeBuilder(keyData, cfg.KeyID, cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+	b.sign.Options = opts
+	for _, key := range cfg.NextKeys {
+		next, err := newNextSign(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "next key %s", key.KeyID)
+		}
+		b.sign.Next = append(b.sign.Next, next)
+	}
+	return b, nil
+}
+
+func newNextSign(key config.SigningKey) (*schema.Sign, error) {
+	body, err := LoadSigningKeyData(&key)
+	if err != nil {
+		return nil, err
+	}
+	b, err := createLocalPrivateSchemeBuilder(body, key.KeyID, key.Password)
+	if err != nil {
+		return nil, err
+	}
+	return b.sign, nil
 }
 
 func createLocalPrivateSchemeBuilder(keyData []byte, keyId string, keyPassword string) (*LocalPrivateSchemeBuilder, error) {
@@ -48,38 +118,64 @@ func createLocalPrivateSchemeBuilder(keyData []byte, keyId string, keyPassword s
 	}
 
 	switch block.Type {
-	case schema.EcKeyType:
-		var rawPk interface{}
-		var err error
-		if keyPassword != "" {
-			rawPk, err = ssh.ParseRawPrivateKeyWithPassphrase(keyData, []byte(keyPassword))
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			rawPk, err = ssh.ParseRawPrivateKey(keyData)
-			if err != nil {
-				return nil, err
-			}
+	case schema.EcKeyType, schema.Pkcs8KeyType, schema.OpenSSHKeyType:
+		rawPk, err := parseRawPrivateKey(keyData, keyPassword)
+		if err != nil {
+			return nil, err
 		}
-
-		pk, ok := rawPk.(*ecdsa.PrivateKey)
-		if !ok {
-			return nil, errors.New("private key is not ecdsa key")
+		s, err := newSign(rawPk, keyId)
+		if err != nil {
+			return nil, err
 		}
-
-		s := &schema.Sign{
-			KeyID: keyId,
-			Algo:  schema.AlgoECDSA,
-			Pk:    pk,
+		return &LocalPrivateSchemeBuilder{sign: s}, nil
+	case schema.EncryptedPkcs8KeyType:
+		if keyPassword == "" {
+			return nil, ErrNoPassword
+		}
+		rawPk, err := parseEncryptedPKCS8PrivateKey(block.Bytes, []byte(keyPassword))
+		if err != nil {
+			return nil, err
+		}
+		s, err := newSign(rawPk, keyId)
+		if err != nil {
+			return nil, err
 		}
-
 		return &LocalPrivateSchemeBuilder{sign: s}, nil
-
 	}
 	return nil, errors.Errorf("unsupported private key type")
 }
 
+// parseRawPrivateKey decodes the key and uses the password only when the key
+// is actually encrypted, so unprotected keys keep working with a password set.
+func parseRawPrivateKey(keyData []byte, keyPassword string) (interface{}, error) {
+	rawPk, err := ssh.ParseRawPrivateKey(keyData)
+	if err == nil {
+		return rawPk, nil
+	}
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return nil, err
+	}
+	if keyPassword == "" {
+		return nil, ErrNoPassword
+	}
+	return ssh.ParseRawPrivateKeyWithPassphrase(keyData, []byte(keyPassword))
+}
+
+func newSign(rawPk interface{}, keyId string) (*schema.Sign, error) {
+	switch pk := rawPk.(type) {
+	case *ecdsa.PrivateKey:
+		return &schema.Sign{KeyID: keyId, Algo: schema.AlgoECDSA, Pk: pk}, nil
+	case ed25519.PrivateKey:
+		return &schema.Sign{KeyID: keyId, Algo: schema.AlgoEd25519, Pk: &pk}, nil
+	case *ed25519.PrivateKey:
+		return &schema.Sign{KeyID: keyId, Algo: schema.AlgoEd25519, Pk: pk}, nil
+	}
+	return nil, errors.New("private key is neither ecdsa nor ed25519 key")
+}
+
+var ErrNoPassword = errors.New("private key is encrypted, but no password is provided")
+
 type LocalPrivateSchemeBuilder struct {
 	sign *schema.Sign
 }
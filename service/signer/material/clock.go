@@ -0,0 +1,50 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock is the source of the created and expires values. It shifts the local time
+// by the offset between the local and the server clocks.
+type Clock struct {
+	offset atomic.Int64
+}
+
+func NewClock(offset time.Duration) *Clock {
+	c := &Clock{}
+	c.SetOffset(offset)
+	return c
+}
+
+// Now returns the local time corrected by the offset, a nil clock returns the local time.
+func (c *Clock) Now() time.Time {
+	return time.Now().Add(c.Offset())
+}
+
+func (c *Clock) Offset() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return time.Duration(c.offset.Load())
+}
+
+func (c *Clock) SetOffset(offset time.Duration) {
+	c.offset.Store(int64(offset))
+}
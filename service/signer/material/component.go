@@ -0,0 +1,239 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	b64 "encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*
+Component parameters, see https://www.rfc-editor.org/rfc/rfc9421#name-http-signature-component-pa */
+
+const (
+	ParamStructured = "sf"
+	ParamKey        = "key"
+	ParamByteSeq    = "bs"
+	ParamRequest    = "req"
+
+	ietfStatus = "@status"
+)
+
+var ErrInvalidComponent = errors.New("invalid component")
+
+// Component is a covered component: the field or derived component name with its parameters.
+type Component struct {
+	Name   string
+	Params Params
+}
+
+// ParseComponent parses the component of the key config, `name` or `name;param...`, the name
+// may be quoted as in the Signature-Input header, e.g. `example-dict;key="a"` or `"@method";req`.
+func ParseComponent(s string) (Component, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, `"`) {
+		name, params, _ := strings.Cut(s, ";")
+		s = strconv.Quote(strings.ToLower(strings.TrimSpace(name)))
+		if params != "" {
+			s += ";" + params
+		}
+	}
+	item, err := ParseItem(s)
+	if err != nil {
+		return Component{}, errors.WithMessage(ErrInvalidComponent, err.Error())
+	}
+	name, ok := item.Value.(string)
+	if !ok || name == "" {
+		return Component{}, errors.WithMessagef(ErrInvalidComponent, "%s: the name is not a string", s)
+	}
+	c := Component{Name: name, Params: item.Params}
+	for i, p := range c.Params {
+		// the key may be given as a token, e.g. in the comma separated flags which do not take quotes
+		if token, ok := p.Value.(Token); ok && p.Key == ParamKey {
+			c.Params[i].Value = string(token)
+		}
+	}
+	return c, c.validate()
+}
+
+func (c Component) validate() error {
+	for _, p := range c.Params {
+		switch p.Key {
+		case ParamStructured, ParamByteSeq, ParamRequest:
+			if p.Value != true {
+				return errors.WithMessagef(ErrInvalidComponent, "%s: %s is a flag", c, p.Key)
+			}
+		case ParamKey:
+			if _, ok := p.Value.(string); !ok {
+				return errors.WithMessagef(ErrInvalidComponent, "%s: %s is not a string", c, p.Key)
+			}
+		default:
+			return errors.WithMessagef(ErrInvalidComponent, "%s: unsupported parameter %s", c, p.Key)
+		}
+	}
+	if len(c.Params) == 0 {
+		return nil
+	}
+	if strings.HasSuffix(c.Name, "*") {
+		return errors.WithMessagef(ErrInvalidComponent, "%s: parameters of a pattern", c)
+	}
+	if c.Has(ParamByteSeq) && (c.Has(ParamStructured) || c.Has(ParamKey)) {
+		return errors.WithMessagef(ErrInvalidComponent, "%s: %s with %s or %s", c, ParamByteSeq, ParamStructured, ParamKey)
+	}
+	if IsDerivedComponent(c.Name) && (c.Has(ParamStructured) || c.Has(ParamKey) || c.Has(ParamByteSeq)) {
+		return errors.WithMessagef(ErrInvalidComponent, "%s: field parameters of a derived component", c)
+	}
+	return nil
+}
+
+// Has reports that the component has the parameter.
+func (c Component) Has(param string) bool {
+	_, ok := c.Params.Get(param)
+	return ok
+}
+
+// String returns the component in the key config form, it is the key of the component in Material.Data.
+func (c Component) String() string {
+	b := new(strings.Builder)
+	b.WriteString(c.Name)
+	c.Params.serialize(b)
+	return b.String()
+}
+
+// Identifier returns the component identifier of the signature base and the @signature-params.
+func (c Component) Identifier() string {
+	return Item{Value: c.Name, Params: c.Params}.String()
+}
+
+// message is the request or the response the components are taken from.
+type message struct {
+	header  http.Header
+	request *http.Request
+	// status is the status code of a response, the request is then the request of the response.
+	status int
+}
+
+func requestMessage(req *http.Request) message {
+	return message{header: req.Header, request: req}
+}
+
+func responseMessage(resp *http.Response) message {
+	return message{header: resp.Header, request: resp.Request, status: resp.StatusCode}
+}
+
+func (msg message) derive(name string) (string, bool) {
+	if msg.status != 0 {
+		if name == ietfStatus {
+			return strconv.Itoa(msg.status), true
+		}
+		return "", false
+	}
+	return DeriveComponent(name, msg.request)
+}
+
+// ComponentValue returns the value of the component with parameters of the request, false when the
+// request does not have it.
+func ComponentValue(c Component, req *http.Request) (string, bool, error) {
+	v, _, ok, err := componentValue(c, requestMessage(req))
+	return v, ok, err
+}
+
+func componentValue(c Component, msg message) (string, componentOrigin, bool, error) {
+	if c.Has(ParamRequest) {
+		if msg.status == 0 {
+			return "", componentOrigin{}, false, errors.WithMessagef(ErrInvalidComponent, "%s: %s is only valid in a response", c, ParamRequest)
+		}
+		if msg.request == nil {
+			return "", componentOrigin{}, false, nil
+		}
+		msg = requestMessage(msg.request)
+	}
+	origin := componentOrigin{source: "request"}
+	if msg.status != 0 {
+		origin.source = "response"
+	}
+	if IsDerivedComponent(c.Name) {
+		v, ok := msg.derive(c.Name)
+		origin.serialization = "derived component"
+		return v, origin, ok, nil
+	}
+
+	values := msg.header.Values(c.Name)
+	if len(values) == 0 {
+		return "", origin, false, nil
+	}
+	origin.source = http.CanonicalHeaderKey(c.Name)
+	origin.raw = strings.Join(values, ", ")
+	trimmed := make([]string, len(values))
+	for i := range values {
+		trimmed[i] = strings.TrimSpace(values[i])
+	}
+	value := strings.Join(trimmed, ", ")
+
+	switch {
+	case c.Has(ParamByteSeq):
+		for i := range trimmed {
+			trimmed[i] = ":" + b64.StdEncoding.EncodeToString([]byte(trimmed[i])) + ":"
+		}
+		origin.serialization = fmt.Sprintf("byte sequence of %d field lines", len(trimmed))
+		return strings.Join(trimmed, ", "), origin, true, nil
+	case c.Has(ParamKey):
+		key, _ := c.Params.Get(ParamKey)
+		dict, err := ParseDictionary(value)
+		if err != nil {
+			return "", origin, false, errors.Wrapf(err, "%s is not a dictionary", c.Name)
+		}
+		member, ok := dict.Get(key.(string))
+		if !ok {
+			return "", origin, false, nil
+		}
+		origin.serialization = fmt.Sprintf("dictionary member %q", key)
+		return sfString(member), origin, true, nil
+	case c.Has(ParamStructured):
+		v, err := parseStructuredField(c.Name, value)
+		if err != nil {
+			return "", origin, false, err
+		}
+		origin.serialization = "strict structured field"
+		return v, origin, true, nil
+	}
+	origin.serialization = "raw field value"
+	return value, origin, true, nil
+}
+
+// parseStructuredField strictly serializes the field value, as a known structured field or as the
+// list or dictionary it parses as.
+func parseStructuredField(name, value string) (string, error) {
+	switch knownFieldTypes[name] {
+	case fieldTypeDictionary:
+		dict, err := ParseDictionary(value)
+		return dict.String(), errors.Wrapf(err, "%s is not a dictionary", name)
+	case fieldTypeList:
+		list, err := ParseList(value)
+		return list.String(), errors.Wrapf(err, "%s is not a list", name)
+	}
+	if list, err := ParseList(value); err == nil {
+		return list.String(), nil
+	}
+	dict, err := ParseDictionary(value)
+	return dict.String(), errors.Wrapf(err, "%s is not a structured field", name)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseComponent(t *testing.T) {
+	tests := []struct {
+		src        string
+		identifier string
+	}{
+		{src: "Content-Type", identifier: `"content-type"`},
+		{src: "example-dict;key=\"a\"", identifier: `"example-dict";key="a"`},
+		{src: `"example-dict";sf`, identifier: `"example-dict";sf`},
+		{src: "example-header; bs", identifier: `"example-header";bs`},
+		{src: "example-dict;key=b", identifier: `"example-dict";key="b"`},
+		{src: "@authority;req", identifier: `"@authority";req`},
+	}
+	for _, tt := range tests {
+		c, err := ParseComponent(tt.src)
+		require.NoError(t, err, tt.src)
+		assert.Equal(t, tt.identifier, c.Identifier())
+	}
+
+	for _, src := range []string{"a;unknown", "a;sf=1", "a;key=1", "a;bs;sf", "@method;sf", "x-*;sf", `"a`} {
+		_, err := ParseComponent(src)
+		assert.ErrorIs(t, err, ErrInvalidComponent, src)
+	}
+}
+
+// The examples of https://www.rfc-editor.org/rfc/rfc9421#name-http-signature-component-pa
+func TestMaterialFromRequest_ComponentParams(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	require.NoError(t, err)
+	req.Header.Set("Example-Dict", " a=1,    b=2;x=1;y=2,   c=(a   b   c)")
+	req.Header.Add("Example-Header", "value, with, lots")
+	req.Header.Add("Example-Header", "of, commas")
+
+	components := []string{"example-dict", "example-dict;sf", `example-dict;key="a"`, `example-dict;key="b"`,
+		`example-dict;key="c"`, `example-dict;key="d"`, "example-header;bs"}
+	m, err := MaterialFromRequest(req, &Options{Profile: RFC9421Profile{}, Components: components})
+	require.NoError(t, err)
+	m.Created, m.Expires, m.Nonce = "1618884473", "1618884773", "b3k2pp5k7z"
+
+	base, params, err := m.GetBody("test-key")
+	require.NoError(t, err)
+	assert.Equal(t, `("example-dict" "example-dict";sf "example-dict";key="a" "example-dict";key="b" "example-dict";key="c" "example-header";bs);created=1618884473;expires=1618884773;nonce="b3k2pp5k7z";keyid="test-key"`, params)
+	assert.Equal(t, `"example-dict": a=1,    b=2;x=1;y=2,   c=(a   b   c)
+"example-dict";sf: a=1, b=2;x=1;y=2, c=(a b c)
+"example-dict";key="a": 1
+"example-dict";key="b": 2;x=1;y=2
+"example-dict";key="c": (a b c)
+"example-header";bs: :dmFsdWUsIHdpdGgsIGxvdHM=:, :b2YsIGNvbW1hcw==:
+"@signature-params": `+params, string(base))
+
+	x := m.Explain("sig1", "test-key", params)
+	assert.Equal(t, `dictionary member "b"`, x.Components[3].Serialization)
+
+	_, err = MaterialFromRequest(req, &Options{Components: []string{"@method;req"}})
+	assert.ErrorIs(t, err, ErrInvalidComponent)
+	_, err = MaterialFromRequest(req, &Options{RequiredComponents: []string{`example-dict;key="d"`}})
+	assert.ErrorIs(t, err, ErrMissingRequiredComponent)
+}
+
+func TestMaterialFromResponse(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "https://example.com/foo", strings.NewReader(`{"hello": "world"}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Request: req}
+	resp.Header.Set("Content-Type", "application/json")
+
+	m, err := MaterialFromResponse(resp, &Options{
+		Profile:    RFC9421Profile{},
+		Components: []string{"@status", "content-type", "@method;req", "@authority;req", "content-type;req"},
+	})
+	require.NoError(t, err)
+	m.Created, m.Expires, m.Nonce = "1618884473", "1618884773", "b3k2pp5k7z"
+	base, params, err := m.GetBody("test-key")
+	require.NoError(t, err)
+	assert.Equal(t, `"@status": 200
+"content-type": application/json
+"@method";req: POST
+"@authority";req: example.com
+"content-type";req: application/json
+"@signature-params": `+params, string(base))
+}
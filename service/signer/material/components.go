@@ -0,0 +1,163 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultExcludedComponents are not covered unless the key config sets its own allow-list or deny-list.
+// A trailing `*` matches the components by prefix.
+var DefaultExcludedComponents = []string{
+	"cf-*",
+	"cdn-*",
+	"cookie*",
+	"x-*",
+}
+
+var ErrMissingRequiredComponent = errors.New("required component is missing")
+
+// Cover removes the components which are not covered by the options and checks the required ones.
+// The derived components and the components with parameters from the allow-list are added even when
+// the profile does not collect them.
+func (e *Material) Cover(req *http.Request, opts *Options) error {
+	return e.cover(requestMessage(req), opts)
+}
+
+func (e *Material) cover(msg message, opts *Options) error {
+	var allowed, excluded, required []string
+	excluded = DefaultExcludedComponents
+	if opts != nil {
+		allowed, required = opts.Components, opts.RequiredComponents
+		if opts.ExcludedComponents != nil {
+			excluded = opts.ExcludedComponents
+		}
+	}
+
+	names := make([]Component, 0, len(e.Names))
+	covered := make(map[string]bool)
+	cover := func(c Component) {
+		if !covered[c.String()] {
+			covered[c.String()] = true
+			names = append(names, c)
+		}
+	}
+	// the components with parameters are taken from the message, not from the collected ones
+	addWithParams := func(pattern string) (bool, error) {
+		c, err := ParseComponent(pattern)
+		if err != nil || len(c.Params) == 0 {
+			return false, err
+		}
+		v, origin, ok, err := componentValue(c, msg)
+		if err != nil {
+			return true, err
+		}
+		if ok && !covered[c.String()] {
+			e.Data[c.String()] = v
+			e.setOrigin(c.String(), origin)
+			cover(c)
+		}
+		return true, nil
+	}
+
+	if len(allowed) > 0 {
+		for _, pattern := range append(append([]string{}, allowed...), required...) {
+			handled, err := addWithParams(pattern)
+			if err != nil {
+				return err
+			}
+			if handled {
+				continue
+			}
+			if IsDerivedComponent(pattern) {
+				if _, ok := e.Data[pattern]; !ok {
+					if v, ok := msg.derive(pattern); ok {
+						e.AppendValue(pattern, v)
+					}
+				}
+			}
+			for _, c := range e.Names {
+				if matchComponent(pattern, c.Name) {
+					cover(c)
+				}
+			}
+		}
+	} else {
+		for _, c := range e.Names {
+			if !matchAny(excluded, c.Name) || matchAny(required, c.Name) {
+				cover(c)
+			}
+		}
+		for _, pattern := range required {
+			if _, err := addWithParams(pattern); err != nil {
+				return err
+			}
+		}
+	}
+	e.Names = names
+
+	missing := make([]string, 0)
+	for _, pattern := range required {
+		found := false
+		c, err := ParseComponent(pattern)
+		for _, name := range e.Names {
+			if err == nil && len(c.Params) > 0 {
+				found = found || name.String() == c.String()
+			} else {
+				found = found || matchComponent(pattern, name.Name)
+			}
+		}
+		if !found {
+			missing = append(missing, pattern)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.WithMessage(ErrMissingRequiredComponent, strings.Join(missing, ", "))
+	}
+	for k := range e.Data {
+		if !covered[k] {
+			delete(e.Data, k)
+		}
+	}
+	return nil
+}
+
+// matchComponent matches the component name with the configured pattern. The pattern matches
+// the structured header components like `name:key` by the header name as well.
+func matchComponent(pattern, name string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(name, prefix)
+	}
+	if pattern == name {
+		return true
+	}
+	header, _, ok := strings.Cut(name, ":")
+	return ok && !IsDerivedComponent(name) && header == pattern
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchComponent(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
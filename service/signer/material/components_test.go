@@ -0,0 +1,95 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newComponentsTestRequest(t *testing.T) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "https://api.example.com/accounts?page=1", strings.NewReader("body"))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	req.Header.Set("X-Request-Id", "1")
+	req.Header.Set("Prefer", "a=1, b=2")
+	return req
+}
+
+func TestMaterialFromRequest_Components(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     *Options
+		expected []string
+		// ordered cases follow the allow-list, the others the random order of the header map
+		ordered bool
+	}{
+		{
+			name:     "default deny-list",
+			opts:     nil,
+			expected: []string{"content-type", "traceparent", "prefer:a", "prefer:b", "@method", "@path", "content-digest", "@query"},
+		},
+		{
+			name:     "allow-list with derived components",
+			opts:     &Options{Components: []string{"@target-uri", "@authority", "prefer", "content-digest"}},
+			expected: []string{"@target-uri", "@authority", "prefer:a", "prefer:b", "content-digest"},
+			ordered:  true,
+		},
+		{
+			name:     "custom deny-list",
+			opts:     &Options{ExcludedComponents: []string{"traceparent", "prefer", "@query"}},
+			expected: []string{"content-type", "x-request-id", "@method", "@path", "content-digest"},
+		},
+		{
+			name:     "required component is covered despite the deny-list",
+			opts:     &Options{RequiredComponents: []string{"x-request-id"}},
+			expected: []string{"content-type", "traceparent", "x-request-id", "prefer:a", "prefer:b", "@method", "@path", "content-digest", "@query"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := MaterialFromRequest(newComponentsTestRequest(t), tt.opts)
+			require.NoError(t, err)
+			names := make([]string, 0, len(m.Names))
+			for _, c := range m.Names {
+				names = append(names, c.String())
+			}
+			if tt.ordered {
+				assert.Equal(t, tt.expected, names)
+			} else {
+				assert.ElementsMatch(t, tt.expected, names)
+			}
+			assert.Len(t, m.Data, len(tt.expected))
+		})
+	}
+	m, err := MaterialFromRequest(newComponentsTestRequest(t), &Options{Components: []string{"@authority"}})
+	require.NoError(t, err)
+	assert.Equal(t, "api.example.com", m.Data["@authority"])
+}
+
+func TestMaterialFromRequest_MissingRequiredComponent(t *testing.T) {
+	_, err := MaterialFromRequest(newComponentsTestRequest(t), &Options{RequiredComponents: []string{"content-type", "idempotency-key"}})
+	require.ErrorIs(t, err, ErrMissingRequiredComponent)
+	assert.Contains(t, err.Error(), "idempotency-key")
+	assert.NotContains(t, err.Error(), "content-type")
+}
@@ -0,0 +1,102 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+/*
+Derived components, see https://www.rfc-editor.org/rfc/rfc9421#name-derived-components */
+
+const (
+	ietfAuthority     = "@authority"
+	ietfTargetURI     = "@target-uri"
+	ietfScheme        = "@scheme"
+	ietfRequestTarget = "@request-target"
+)
+
+// DeriveComponent returns the value of the derived component of the request, false for an unknown component.
+func DeriveComponent(name string, req *http.Request) (string, bool) {
+	target := targetURI(req)
+	switch name {
+	case ietfMethod:
+		return strings.ToUpper(req.Method), true
+	case ietfAuthority:
+		return authority(target), true
+	case ietfTargetURI:
+		return target.String(), true
+	case ietfScheme:
+		return target.Scheme, true
+	case ietfPath:
+		return absolutePath(target), true
+	case ietfQuery:
+		return "?" + target.RawQuery, true
+	case ietfRequestTarget:
+		if target.RawQuery == "" {
+			return absolutePath(target), true
+		}
+		return absolutePath(target) + "?" + target.RawQuery, true
+	}
+	return "", false
+}
+
+func IsDerivedComponent(name string) bool {
+	return strings.HasPrefix(name, "@")
+}
+
+// targetURI returns the absolute request URI, also for the requests read by a server.
+func targetURI(req *http.Request) *url.URL {
+	target := *req.URL
+	if target.Host == "" {
+		target.Host = req.Host
+	}
+	if target.Scheme == "" {
+		target.Scheme = "http"
+		if req.TLS != nil {
+			target.Scheme = "https"
+		}
+	}
+	target.Host = strings.ToLower(target.Host)
+	target.Fragment = ""
+	target.RawFragment = ""
+	return &target
+}
+
+func absolutePath(target *url.URL) string {
+	if path := target.EscapedPath(); path != "" {
+		return path
+	}
+	return "/"
+}
+
+func authority(target *url.URL) string {
+	host, port, err := net.SplitHostPort(target.Host)
+	if err != nil {
+		return target.Host
+	}
+	if (target.Scheme == "http" && port == "80") || (target.Scheme == "https" && port == "443") {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return target.Host
+}
@@ -0,0 +1,200 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"net/textproto"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+/*
+The Content-Digest and Want-Content-Digest fields follow https://www.rfc-editor.org/rfc/rfc9530 */
+
+const (
+	DigestSha256 = "sha-256"
+	DigestSha512 = "sha-512"
+
+	DefaultDigestAlgorithm = DigestSha512
+)
+
+var WantContentDigestHeader = textproto.CanonicalMIMEHeaderKey("Want-Content-Digest")
+
+var (
+	ErrUnsupportedDigest = errors.New("unsupported digest algorithm")
+	ErrDigestMismatch    = errors.New("content digest mismatch")
+	ErrNoSupportedDigest = errors.New("content digest has no supported algorithm")
+)
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	DigestSha256: sha256.New,
+	DigestSha512: sha512.New,
+}
+
+func DigestAlgorithms() []string {
+	names := make([]string, 0, len(digestAlgorithms))
+	for name := range digestAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Digest selects the Content-Digest algorithm: the configured one, unless the upstream
+// asked for another one with the Want-Content-Digest header.
+type Digest struct {
+	algorithm string
+	wanted    atomic.Value
+}
+
+// NewDigest returns the digest of the algorithm, the empty name selects DefaultDigestAlgorithm.
+func NewDigest(algorithm string) (*Digest, error) {
+	if algorithm == "" {
+		algorithm = DefaultDigestAlgorithm
+	}
+	if _, ok := digestAlgorithms[algorithm]; !ok {
+		return nil, errors.WithMessagef(ErrUnsupportedDigest, "%s, supported algorithms: %s", algorithm, strings.Join(DigestAlgorithms(), ", "))
+	}
+	return &Digest{algorithm: algorithm}, nil
+}
+
+// Algorithm returns the algorithm wanted by the upstream or the configured one, a nil digest returns DefaultDigestAlgorithm.
+func (d *Digest) Algorithm() string {
+	if d == nil {
+		return DefaultDigestAlgorithm
+	}
+	if wanted, ok := d.wanted.Load().(string); ok && wanted != "" {
+		return wanted
+	}
+	return d.algorithm
+}
+
+// Want applies the Want-Content-Digest preference of the upstream and reports whether the algorithm has changed.
+// The preference is ignored when it lists no supported algorithm.
+func (d *Digest) Want(value string) bool {
+	wanted := PreferredDigest(value)
+	if wanted == "" {
+		return false
+	}
+	prev := d.Algorithm()
+	d.wanted.Store(wanted)
+	return prev != wanted
+}
+
+// PreferredDigest returns the supported algorithm with the highest preference of the
+// Want-Content-Digest value, or the empty string when none is acceptable.
+func PreferredDigest(value string) string {
+	dict, err := ParseDictionary(value)
+	if err != nil {
+		return ""
+	}
+	res, best := "", int64(0)
+	for _, member := range dict {
+		item, ok := member.Member.(Item)
+		if !ok {
+			continue
+		}
+		w, ok := item.Value.(int64)
+		if b, isBool := item.Value.(bool); isBool && b {
+			// a bare key is the boolean true, that is the preference 1
+			w, ok = 1, true
+		}
+		if !ok || w <= 0 {
+			continue
+		}
+		if _, ok := digestAlgorithms[member.Key]; !ok {
+			continue
+		}
+		if w > best || (w == best && member.Key > res) {
+			res, best = member.Key, w
+		}
+	}
+	return res
+}
+
+// ContentDigest returns the Content-Digest header value for the body with DefaultDigestAlgorithm.
+func ContentDigest(body []byte) string {
+	value, _ := ContentDigestWith(DefaultDigestAlgorithm, body)
+	return value
+}
+
+// ContentDigestWith returns the Content-Digest header value for the body with the algorithm.
+func ContentDigestWith(algorithm string, body []byte) (string, error) {
+	sum, err := digestOf(algorithm, body)
+	if err != nil {
+		return "", err
+	}
+	return algorithm + "=:" + base64.StdEncoding.EncodeToString(sum) + ":", nil
+}
+
+func digestOf(algorithm string, body []byte) ([]byte, error) {
+	newHash, ok := digestAlgorithms[algorithm]
+	if !ok {
+		return nil, errors.WithMessage(ErrUnsupportedDigest, algorithm)
+	}
+	h := newHash()
+	_, _ = h.Write(body)
+	return h.Sum(nil), nil
+}
+
+// ExpectedContentDigest returns the Content-Digest value the body should have with the algorithms
+// of the received header, DefaultDigestAlgorithm when the header has no supported algorithm.
+func ExpectedContentDigest(received string, body []byte) string {
+	values := make([]string, 0)
+	dict, _ := ParseDictionary(received)
+	for _, member := range dict {
+		if value, err := ContentDigestWith(member.Key, body); err == nil {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return ContentDigest(body)
+	}
+	return strings.Join(values, ", ")
+}
+
+// VerifyContentDigest checks every supported algorithm of the Content-Digest value against the body.
+func VerifyContentDigest(value string, body []byte) error {
+	dict, err := ParseDictionary(value)
+	if err != nil {
+		return errors.Wrap(err, "Content-Digest")
+	}
+	checked := 0
+	for _, member := range dict {
+		expected, err := digestOf(member.Key, body)
+		if err != nil {
+			continue
+		}
+		checked++
+		item, _ := member.Member.(Item)
+		if received, ok := item.Value.([]byte); !ok || !bytes.Equal(received, expected) {
+			return errors.WithMessagef(ErrDigestMismatch, "%s, expected %s=:%s:", Dictionary{member}, member.Key, base64.StdEncoding.EncodeToString(expected))
+		}
+	}
+	if checked == 0 {
+		return errors.WithMessage(ErrNoSupportedDigest, value)
+	}
+	return nil
+}
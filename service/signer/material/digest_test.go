@@ -0,0 +1,80 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreferredDigest(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{value: "sha-256=1, sha-512=3", expected: DigestSha512},
+		{value: "sha-512=1, sha-256=10", expected: DigestSha256},
+		{value: "sha-512=0, sha-256=1", expected: DigestSha256},
+		{value: "unixsum=10, sha-256=1", expected: DigestSha256},
+		{value: "md5=1", expected: ""},
+		{value: "sha-256, sha-512=2", expected: DigestSha512},
+		{value: "sha-512=?0, sha-256=1;q=2", expected: DigestSha256},
+		{value: "sha-512=3 sha-256=1", expected: ""},
+		{value: "", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			assert.Equal(t, tt.expected, PreferredDigest(tt.value))
+		})
+	}
+}
+
+func TestVerifyContentDigest(t *testing.T) {
+	// test vectors from RFC 9530, section B.1
+	body := []byte(`{"hello": "world"}` + "\n")
+	sha256 := "sha-256=:RK/0qy18MlBSVnWgjwz6lZEWjP/lF5HF9bvEF8FabDg=:"
+	sha512 := "sha-512=:YMAam51Jz/jOATT6/zvHrLVgOYTGFy1d6GJiOHTohq4yP+pgk4vf2aCsyRZOtw8MjkM7iw7yZ/WkppmM44T3qg==:"
+
+	assert.NoError(t, VerifyContentDigest(sha256, body))
+	assert.NoError(t, VerifyContentDigest(sha256+", "+sha512, body))
+	assert.NoError(t, VerifyContentDigest("unixsum=:AAAA:, "+sha512, body))
+	assert.ErrorIs(t, VerifyContentDigest(sha512, body[:10]), ErrDigestMismatch)
+	assert.ErrorIs(t, VerifyContentDigest("unixsum=:AAAA:", body), ErrNoSupportedDigest)
+	assert.ErrorIs(t, VerifyContentDigest("sha-256=1", body), ErrDigestMismatch)
+	assert.Error(t, VerifyContentDigest("sha-256=:RK/0", body))
+
+	value, err := ContentDigestWith(DigestSha256, body)
+	require.NoError(t, err)
+	assert.Equal(t, sha256, value)
+	assert.Equal(t, sha512, ContentDigest(body))
+}
+
+func TestDigest_Want(t *testing.T) {
+	d, err := NewDigest("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultDigestAlgorithm, d.Algorithm())
+
+	assert.False(t, d.Want("md5=1"))
+	assert.True(t, d.Want("sha-256=1"))
+	assert.Equal(t, DigestSha256, d.Algorithm())
+	assert.False(t, d.Want("sha-256=2"))
+
+	_, err = NewDigest("md5")
+	assert.ErrorIs(t, err, ErrUnsupportedDigest)
+}
@@ -0,0 +1,152 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ExplainJSON  = "json"
+	ExplainTable = "table"
+)
+
+var ErrUnsupportedExplainFormat = errors.New("unsupported explain format")
+
+func ExplainFormats() []string {
+	return []string{ExplainJSON, ExplainTable}
+}
+
+// Explanation describes how the signature base of one signature was built.
+type Explanation struct {
+	Label           string                 `json:"label"`
+	Method          string                 `json:"method"`
+	TargetURI       string                 `json:"target_uri"`
+	KeyID           string                 `json:"keyid"`
+	Profile         string                 `json:"profile"`
+	Components      []ComponentExplanation `json:"components"`
+	SignatureParams string                 `json:"signature_params"`
+	DigestAlgorithm string                 `json:"digest_algorithm,omitempty"`
+	ContentDigest   string                 `json:"content_digest,omitempty"`
+	SignatureBase   string                 `json:"signature_base"`
+}
+
+// ComponentExplanation describes one covered component: where it comes from, its value before
+// and after the normalisation and how the value was serialized.
+type ComponentExplanation struct {
+	Name          string `json:"name"`
+	Source        string `json:"source"`
+	RawValue      string `json:"raw_value,omitempty"`
+	Value         string `json:"value"`
+	Serialization string `json:"serialization"`
+}
+
+// componentOrigin is recorded by the profiles when they add a component.
+type componentOrigin struct {
+	source        string
+	raw           string
+	serialization string
+}
+
+func (e *Material) setOrigin(name string, origin componentOrigin) {
+	if e.origins == nil {
+		e.origins = make(map[string]componentOrigin)
+	}
+	e.origins[name] = origin
+}
+
+// Explain describes the signature base built for the signature with the @signature-params value.
+func (e *Material) Explain(label, keyID, signatureParams string) Explanation {
+	res := Explanation{
+		Label:           label,
+		Method:          e.method,
+		TargetURI:       e.target,
+		KeyID:           keyID,
+		Profile:         e.Profile.Name(),
+		Components:      make([]ComponentExplanation, 0, len(e.Names)),
+		SignatureParams: signatureParams,
+		SignatureBase:   string(e.Profile.SignatureBase(e, signatureParams)),
+	}
+	for _, c := range e.Names {
+		name := c.String()
+		origin, ok := e.origins[name]
+		if !ok {
+			// the derived components added by Cover have no recorded origin
+			origin = componentOrigin{source: "request", serialization: "derived component"}
+		}
+		res.Components = append(res.Components, ComponentExplanation{
+			Name:          name,
+			Source:        origin.source,
+			RawValue:      origin.raw,
+			Value:         e.Data[name],
+			Serialization: origin.serialization,
+		})
+		if name == ietfContentDigest {
+			res.DigestAlgorithm = e.DigestAlgorithm
+			res.ContentDigest = e.Data[name]
+		}
+	}
+	return res
+}
+
+// FormatExplanations renders the explanations of a request as one JSON document or one table,
+// so the output of concurrent requests does not interleave.
+func FormatExplanations(format string, explanations []Explanation) (string, error) {
+	switch format {
+	case ExplainJSON:
+		out, err := json.Marshal(explanations)
+		if err != nil {
+			return "", errors.Wrap(err, "marshal explanations")
+		}
+		return string(out), nil
+	case ExplainTable:
+		out := new(strings.Builder)
+		for _, x := range explanations {
+			x.writeTable(out)
+		}
+		return strings.TrimSuffix(out.String(), "\n"), nil
+	}
+	return "", errors.WithMessage(ErrUnsupportedExplainFormat, format)
+}
+
+func (x Explanation) writeTable(out *strings.Builder) {
+	fmt.Fprintf(out, "Signature %s of %s %s, keyid %q, profile %s\n", x.Label, x.Method, x.TargetURI, x.KeyID, x.Profile)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "  COMPONENT\tSOURCE\tSERIALIZATION\tRAW VALUE\tVALUE")
+	for _, c := range x.Components {
+		raw := c.RawValue
+		if raw == c.Value {
+			raw = "="
+		}
+		_, _ = fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", c.Name, c.Source, c.Serialization, raw, c.Value)
+	}
+	_ = w.Flush()
+	fmt.Fprintf(out, "  @signature-params: %s\n", x.SignatureParams)
+	if x.ContentDigest != "" {
+		fmt.Fprintf(out, "  content digest (%s): %s\n", x.DigestAlgorithm, x.ContentDigest)
+	}
+	fmt.Fprintf(out, "  signature base:\n%s\n", indent(x.SignatureBase, "    "))
+}
+
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalise_Serializations(t *testing.T) {
+	tests := []struct {
+		header         string
+		value          string
+		keys           []string
+		serializations []string
+	}{
+		{header: "Accept", value: "a, b", keys: []string{"accept"}, serializations: []string{"list of 2 members"}},
+		{header: "Content-Type", value: "application/json", keys: []string{"content-type"}, serializations: []string{"item"}},
+		{header: "X-Empty", value: "", keys: []string{"x-empty"}, serializations: []string{"empty value"}},
+		{header: "X-List", value: "(a b)", keys: []string{"x-list:0", "x-list:1", "x-list:2"}, serializations: []string{
+			"inner-list prefix 0 of 2 members", "inner-list prefix 1 of 2 members", "inner-list prefix 2 of 2 members",
+		}},
+		{header: "X-Dict", value: "a=1", keys: []string{"x-dict:a"}, serializations: []string{`dictionary member "a"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			keys, _, serializations, err := normalise(tt.header, []string{tt.value})
+			require.NoError(t, err)
+			assert.Equal(t, tt.keys, keys)
+			assert.Equal(t, tt.serializations, serializations)
+		})
+	}
+}
+
+func TestMaterial_Explain(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "https://example.com/orders", strings.NewReader(`{"a":1}`))
+	require.NoError(t, err)
+	req.Header.Set("Accept", "a, b")
+	req.Header.Set("Content-Type", "application/json")
+
+	m, err := MaterialFromRequest(req, &Options{})
+	require.NoError(t, err)
+	_, params, err := m.GetBody("test-key")
+	require.NoError(t, err)
+	x := m.Explain("sig1", "test-key", params)
+
+	assert.Equal(t, DefaultProfileName, x.Profile)
+	assert.Equal(t, http.MethodPost, x.Method)
+	assert.Equal(t, "https://example.com/orders", x.TargetURI)
+	assert.Equal(t, params, x.SignatureParams)
+	assert.True(t, strings.HasSuffix(x.SignatureBase, `"@signature-params": `+params))
+	assert.Equal(t, m.DigestAlgorithm, x.DigestAlgorithm)
+	assert.Equal(t, m.Data["content-digest"], x.ContentDigest)
+	components := make(map[string]ComponentExplanation)
+	for _, c := range x.Components {
+		components[c.Name] = c
+	}
+	assert.Equal(t, ComponentExplanation{Name: "accept", Source: "Accept", RawValue: "a, b", Value: "a, b", Serialization: "list of 2 members"}, components["accept"])
+	assert.Equal(t, "derived component", components["@method"].Serialization)
+	assert.Equal(t, "body", components["content-digest"].Source)
+
+	out, err := FormatExplanations(ExplainJSON, []Explanation{x})
+	require.NoError(t, err)
+	var decoded []Explanation
+	require.NoError(t, json.Unmarshal([]byte(out), &decoded))
+	assert.Equal(t, []Explanation{x}, decoded)
+
+	out, err = FormatExplanations(ExplainTable, []Explanation{x})
+	require.NoError(t, err)
+	assert.Contains(t, out, `Signature sig1 of POST https://example.com/orders, keyid "test-key"`)
+	assert.Contains(t, out, "list of 2 members")
+	assert.Contains(t, out, "@signature-params: "+params)
+
+	_, err = FormatExplanations("yaml", []Explanation{x})
+	assert.ErrorIs(t, err, ErrUnsupportedExplainFormat)
+}
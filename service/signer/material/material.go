@@ -17,16 +17,13 @@ limitations under the License.
 package material
 
 import (
-	"bytes"
-	"crypto/sha512"
-	"encoding/base64"
 	"fmt"
 	"net/http"
 	"net/textproto"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/ory/x/randx"
 	"github.com/pkg/errors"
 )
 
@@ -36,6 +33,8 @@ const (
 	ietfQuery           = "@query"
 	ietfContentDigest   = "content-digest"
 	ietfSignatureParams = "@signature-params"
+
+	ContentDigestComponent = ietfContentDigest
 )
 
 var (
@@ -43,80 +42,179 @@ var (
 	SignatureInputHeader = textproto.CanonicalMIMEHeaderKey("Signature-Input")
 	SigningVersionHeader = textproto.CanonicalMIMEHeaderKey("Upvest-Signature-Version")
 	ContentDigestHeader  = textproto.CanonicalMIMEHeaderKey("Content-Digest")
+)
+
+// Options are the per key settings used to build the material.
+type Options struct {
+	Profile Profile
+	// Components is the allow-list of the covered components, every collected component is covered when it is empty.
+	Components []string
+	// ExcludedComponents is the deny-list used without the allow-list, DefaultExcludedComponents when it is nil.
+	ExcludedComponents []string
+	// RequiredComponents must be present in the request, the signing fails otherwise.
+	RequiredComponents []string
+	// Lifetime is the validity of the signature, DefaultLifetime when it is zero.
+	Lifetime time.Duration
+	// Clock is the source of the created and expires values, the local time when it is nil.
+	Clock *Clock
+	// Nonce generates the nonces, NumericNonce of DefaultNonceLength when it is nil.
+	Nonce NonceGenerator
+	// Digest selects the Content-Digest algorithm, DefaultDigestAlgorithm when it is nil.
+	Digest *Digest
+}
 
-	ignoreHeadersWithPrefix = []string{
-		"cf-",
-		"cdn-",
-		"cookie",
-		"x-",
+const DefaultLifetime = time.Minute
+
+var defaultNonce = NumericNonce(DefaultNonceLength)
+
+func (o *Options) profile() Profile {
+	if o == nil || o.Profile == nil {
+		p, _ := GetProfile(DefaultProfileName)
+		return p
 	}
-)
+	return o.Profile
+}
+
+func (o *Options) lifetime() time.Duration {
+	if o == nil || o.Lifetime <= 0 {
+		return DefaultLifetime
+	}
+	return o.Lifetime
+}
+
+func (o *Options) clock() *Clock {
+	if o == nil {
+		return nil
+	}
+	return o.Clock
+}
+
+func (o *Options) digest() *Digest {
+	if o == nil {
+		return nil
+	}
+	return o.Digest
+}
+
+func (o *Options) nonce() NonceGenerator {
+	if o == nil || o.Nonce == nil {
+		return defaultNonce
+	}
+	return o.Nonce
+}
 
 type Material struct {
+	// Data are the component values by Component.String.
 	Data           map[string]string
-	Names          []string
+	Names          []Component
 	Created        string
 	Expires        string
 	Nonce          string
 	Body           []byte
 	SourceBody     []byte
 	SignatureInput string
+	Profile        Profile
+	// DigestAlgorithm is used for the Content-Digest of the body.
+	DigestAlgorithm string
+	// Explaining makes the signing add the Explanations, building them costs a second signature base.
+	Explaining bool
+	// Explanations describe the signature base of every signature, they are added by the signing.
+	Explanations []Explanation
+
+	origins map[string]componentOrigin
+	// method and target are the request the explanations belong to.
+	method string
+	target string
 }
 
-func newMaterial() *Material {
+func newMaterial(opts *Options) (*Material, error) {
+	nonce, err := opts.nonce()()
+	if err != nil {
+		return nil, err
+	}
+	now := opts.clock().Now()
 	return &Material{
 		Data:    make(map[string]string),
-		Names:   make([]string, 0),
-		Created: fmt.Sprintf("%d", time.Now().Unix()),
-		Nonce:   randx.MustString(10, randx.Numeric),
-		Expires: fmt.Sprintf("%d", time.Now().Add(time.Minute).Unix()),
-	}
+		Names:   make([]Component, 0),
+		Created: fmt.Sprintf("%d", now.Unix()),
+		Nonce:   nonce,
+		Expires: fmt.Sprintf("%d", now.Add(opts.lifetime()).Unix()),
+		Profile: opts.profile(),
+
+		DigestAlgorithm: opts.digest().Algorithm(),
+	}, nil
 }
 
+// GetBody serializes the signature base with the material profile and returns it with the @signature-params value.
 func (e *Material) GetBody(keyID string) ([]byte, string, error) {
-	quoteNames := make([]string, len(e.Names))
-	for i, s := range e.Names {
-		quoteNames[i] = fmt.Sprintf("%q", s)
-	}
-	names := strings.Join(quoteNames, " ")
-
-	signatureParams := fmt.Sprintf("(%s);keyid=%q;created=%s;nonce=%q;expires=%s", names, keyID, e.Created, e.Nonce, e.Expires)
+	signatureParams := e.Profile.SignatureParams(e, keyID)
+	e.Body = e.Profile.SignatureBase(e, signatureParams)
+	return e.Body, signatureParams, nil
+}
 
-	e.CompleteWithSourceBody(ietfSignatureParams, signatureParams)
+// MaterialFromRequest collects the components of the request and keeps the ones covered by the options.
+func MaterialFromRequest(req *http.Request, opts *Options) (*Material, error) {
+	e, err := CollectFromRequest(req, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.Cover(req, opts); err != nil {
+		return nil, errors.Wrap(err, "cover")
+	}
+	return e, nil
+}
 
-	return e.Body, signatureParams, nil
+// MaterialFromResponse collects the header fields and the @status of the response and keeps the
+// ones covered by the options. The components with the req parameter come from the request of the response.
+func MaterialFromResponse(resp *http.Response, opts *Options) (*Material, error) {
+	e, err := newMaterial(opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "newMaterial")
+	}
+	if err := e.AppendHeaders(resp.Header); err != nil {
+		return nil, errors.Wrap(err, "appendHeaders")
+	}
+	e.AppendValue(ietfStatus, strconv.Itoa(resp.StatusCode))
+	if err := e.cover(responseMessage(resp), opts); err != nil {
+		return nil, errors.Wrap(err, "cover")
+	}
+	return e, nil
 }
 
-func MaterialFromRequest(req *http.Request) (*Material, error) {
-	e := newMaterial()
+// CollectFromRequest collects all the components of the request the profile knows about.
+func CollectFromRequest(req *http.Request, opts *Options) (*Material, error) {
+	e, err := newMaterial(opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "newMaterial")
+	}
 
 	if err := e.AppendHeaders(req.Header); err != nil {
 		return nil, errors.Wrap(err, "appendHeaders")
 	}
 
-	e.AppendValue(ietfMethod, req.Method)
-	if len(req.URL.Path) > 0 {
-		e.AppendValue(ietfPath, req.URL.Path)
-	}
 	body, err := GetRequestBody(req)
 	if err != nil {
 		return nil, errors.Wrap(err, "getRequestBody")
 	}
-	if len(body) > 0 {
-		e.addContentDigest(body, req.Header)
-	}
-	if len(req.URL.RawQuery) > 0 {
-		e.AppendValue(ietfQuery, "?"+req.URL.RawQuery)
-	}
+	e.Profile.AppendDerived(e, req, body)
+	e.method = strings.ToUpper(req.Method)
+	e.target = targetURI(req).String()
 
 	return e, nil
 }
 
-func (e *Material) addContentDigest(body []byte, headers http.Header) {
-	data := sha512.Sum512(body)
-	hash := "sha-512=:" + base64.StdEncoding.EncodeToString(data[:]) + ":"
+// AddContentDigest sets the Content-Digest header of the body and adds it to the components.
+// The algorithm was checked by NewDigest, an unknown one is replaced by DefaultDigestAlgorithm,
+// which the explanation shows.
+func (e *Material) AddContentDigest(body []byte, headers http.Header) {
+	hash, err := ContentDigestWith(e.DigestAlgorithm, body)
+	if err != nil {
+		e.DigestAlgorithm = DefaultDigestAlgorithm
+		hash = ContentDigest(body)
+	}
 	headers.Set(ContentDigestHeader, hash)
 	e.AppendValue(ietfContentDigest, hash)
+	e.setOrigin(ietfContentDigest, componentOrigin{source: "body", serialization: "content digest of the body"})
 }
 
 func (e *Material) AppendHeaders(headers http.Header) error {
@@ -132,40 +230,14 @@ func (e *Material) AppendArray(k string, v []string) error {
 	if k == SignatureHeader || k == SignatureInputHeader {
 		return nil
 	}
-	nk, nv, err := Normalise(k, v)
-	if err != nil {
-		return errors.Wrap(err, "normalisation error")
-	}
-	for i := 0; i < len(nk); i++ {
-		e.AppendValue(nk[i], nv[i])
-	}
-	return nil
+	return e.Profile.AppendHeader(e, k, v)
 }
 
 func (e *Material) AppendValue(k, v string) {
-	for _, prefix := range ignoreHeadersWithPrefix {
-		if strings.HasPrefix(k, prefix) {
-			return
-		}
-	}
-	e.Data[k] = v
-	e.Names = append(e.Names, k)
+	e.AppendComponent(Component{Name: k}, v)
 }
 
-func (e *Material) CompleteWithSourceBody(postBodyData ...string) {
-	buf := new(bytes.Buffer)
-	for _, s := range e.Names {
-		buf.WriteString(Format(s, e.Data[s]))
-		buf.WriteByte('\n')
-	}
-	if e.Body != nil {
-		buf.Write(e.Body)
-	}
-	if len(postBodyData) > 0 {
-		if e.Body != nil {
-			buf.WriteByte('\n')
-		}
-		buf.WriteString(Format(postBodyData[0], postBodyData[1]))
-	}
-	e.Body = buf.Bytes()
+func (e *Material) AppendComponent(c Component, v string) {
+	e.Data[c.String()] = v
+	e.Names = append(e.Names, c)
 }
@@ -0,0 +1,65 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaterialFromRequest_Lifetime(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		opts     *Options
+		offset   time.Duration
+		lifetime time.Duration
+		nonceLen int
+	}{
+		{name: "defaults", opts: nil, lifetime: DefaultLifetime, nonceLen: DefaultNonceLength},
+		{
+			name:     "configured",
+			opts:     &Options{Lifetime: 10 * time.Minute, Clock: NewClock(-time.Hour), Nonce: NumericNonce(32)},
+			offset:   -time.Hour,
+			lifetime: 10 * time.Minute,
+			nonceLen: 32,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := MaterialFromRequest(req, tt.opts)
+			require.NoError(t, err)
+
+			created, err := strconv.ParseInt(m.Created, 10, 64)
+			require.NoError(t, err)
+			expires, err := strconv.ParseInt(m.Expires, 10, 64)
+			require.NoError(t, err)
+			assert.InDelta(t, time.Now().Add(tt.offset).Unix(), created, 1)
+			assert.Equal(t, int64(tt.lifetime.Seconds()), expires-created)
+			assert.Len(t, m.Nonce, tt.nonceLen)
+			_, err = strconv.ParseUint(m.Nonce, 10, 64)
+			assert.True(t, err == nil || tt.nonceLen > 19)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"crypto/rand"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultNonceLength = 10
+	numericAlphabet    = "0123456789"
+)
+
+// NonceGenerator returns a new nonce for every signature.
+type NonceGenerator func() (string, error)
+
+// NumericNonce generates the nonces of the given number of random digits with crypto/rand.
+func NumericNonce(length int) NonceGenerator {
+	if length <= 0 {
+		length = DefaultNonceLength
+	}
+	limit := big.NewInt(int64(len(numericAlphabet)))
+	return func() (string, error) {
+		nonce := make([]byte, length)
+		for i := range nonce {
+			n, err := rand.Int(rand.Reader, limit)
+			if err != nil {
+				return "", errors.Wrap(err, "nonce")
+			}
+			nonce[i] = numericAlphabet[n.Int64()]
+		}
+		return string(nonce), nil
+	}
+}
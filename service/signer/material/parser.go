@@ -23,66 +23,43 @@ import (
 	"github.com/pkg/errors"
 )
 
-type vType int
+var ErrWrongKeySymbol = errors.New("wrong key symbol")
 
-/*
-This parser is based on https://datatracker.ietf.org/doc/html/draft-ietf-httpbis-message-signatures-06 */
+type fieldType int
 
 const (
-	vTypeInnerList vType = iota + 1
-	vTypeList
-	vTypeValue
-	vTypeMap
-)
-
-type parser func(string) (interface{}, error)
-
-var (
-	ErrWrongValueSymbol     = errors.New("wrong value symbol")
-	ErrImbalancedQuotes     = errors.New("imbalanced quotes")
-	ErrWrongKeySymbol       = errors.New("wrong key symbol")
-	ErrUnknownMaterialValue = errors.New("unknown material value")
+	fieldTypeList fieldType = iota + 1
+	fieldTypeDictionary
 )
 
-var parsers = map[vType]parser{
-	vTypeInnerList: parseInnerList,
-	vTypeList:      parseList,
-	vTypeMap:       parseMap,
-	vTypeValue:     parseList,
+// knownFieldTypes are the structured fields which are dictionaries even when the value parses as a list.
+var knownFieldTypes = map[string]fieldType{
+	"signature":           fieldTypeDictionary,
+	"signature-input":     fieldTypeDictionary,
+	"accept-signature":    fieldTypeDictionary,
+	"content-digest":      fieldTypeDictionary,
+	"repr-digest":         fieldTypeDictionary,
+	"want-content-digest": fieldTypeDictionary,
+	"want-repr-digest":    fieldTypeDictionary,
+	"priority":            fieldTypeDictionary,
+	"cdn-cache-control":   fieldTypeDictionary,
+	"cache-status":        fieldTypeList,
+	"proxy-status":        fieldTypeList,
 }
 
-func parseHeaderValue(src string) (vType, interface{}, error) {
-	vt := getValueType(src, 0)
-	v, err := parsers[vt](src)
-	return vt, v, err
-}
-
-func getValueType(src string, p int) vType {
-	if src[p] == '(' {
-		return vTypeInnerList
-	}
-	if src[p] == '"' {
-		return vTypeList
-	}
-	for e := p + 1; e < len(src); e++ {
-		if src[e] == '=' { // nolint
-			return vTypeMap
-		} else if src[e] == ',' {
-			return vTypeList
-		} else if !allowedForKey(src[e]) {
-			return vTypeValue
-		}
-	}
-	return vTypeValue
+func Normalise(k string, v []string) ([]string, []string, error) {
+	keyList, valueList, _, err := normalise(k, v)
+	return keyList, valueList, err
 }
 
-func Normalise(k string, v []string) ([]string, []string, error) {
-	keyList := make([]string, 0)
-	valueList := make([]string, 0)
+// normalise also returns how every value was serialized, for the explanations of the signature base.
+// A value which parses as an RFC 8941 list or dictionary is strictly serialized: a single inner
+// list is covered by its prefixes and a dictionary by its members. Other values are kept as they are.
+func normalise(k string, v []string) ([]string, []string, []string, error) {
 	nk := strings.TrimSpace(strings.ToLower(k))
 	for i := range nk {
 		if !allowedForKey(nk[i]) {
-			return nil, nil, errors.Wrap(ErrWrongKeySymbol, nk)
+			return nil, nil, nil, errors.Wrap(ErrWrongKeySymbol, nk)
 		}
 	}
 	trimmed := make([]string, len(v))
@@ -91,47 +68,61 @@ func Normalise(k string, v []string) ([]string, []string, error) {
 	}
 	nv := strings.Join(trimmed, ", ")
 	if len(nv) == 0 {
-		return []string{nk}, []string{""}, nil
+		return []string{nk}, []string{""}, []string{"empty value"}, nil
 	}
-	vt, obj, err := parseHeaderValue(nv)
-	if err != nil {
-		return nil, nil, errors.Wrap(err, nv)
-	}
-	switch vt {
-	case vTypeValue:
-		list, ok := obj.([]string)
-		if !ok {
-			return nil, nil, ErrUnknownMaterialValue
-		}
-		keyList = append(keyList, nk)
-		valueList = append(valueList, list[0])
-	case vTypeList:
-		list, ok := obj.([]string)
-		if !ok {
-			return nil, nil, ErrUnknownMaterialValue
-		}
-		keyList = append(keyList, nk)
-		valueList = append(valueList, strings.Join(list, ", "))
-	case vTypeInnerList:
-		list, ok := obj.([]string)
-		if !ok {
-			return nil, nil, ErrUnknownMaterialValue
-		}
-		keyList = append(keyList, nk+":0")
-		valueList = append(valueList, "()")
-		for i := range list {
-			keyList = append(keyList, fmt.Sprintf(nk+":%d", i+1))
-			valueList = append(valueList, fmt.Sprintf("(%s)", strings.Join(list[0:i+1], ", ")))
-		}
-	case vTypeMap:
-		list, ok := obj.(map[string]string)
-		if !ok {
-			return nil, nil, ErrUnknownMaterialValue
+
+	if knownFieldTypes[nk] != fieldTypeDictionary {
+		if list, err := ParseList(nv); err == nil {
+			return normaliseList(nk, list)
 		}
-		for k, v := range list {
-			keyList = append(keyList, fmt.Sprintf(nk+":%s", k))
-			valueList = append(valueList, fmt.Sprintf("%v", v))
+	}
+	if knownFieldTypes[nk] != fieldTypeList {
+		if dict, err := ParseDictionary(nv); err == nil {
+			return normaliseDictionary(nk, dict)
 		}
 	}
-	return keyList, valueList, nil
+	return []string{nk}, []string{nv}, []string{"raw field value"}, nil
+}
+
+func normaliseList(k string, list List) ([]string, []string, []string, error) {
+	if len(list) > 1 {
+		return []string{k}, []string{list.String()}, []string{fmt.Sprintf("list of %d members", len(list))}, nil
+	}
+	innerList, ok := list[0].(InnerList)
+	if !ok {
+		return []string{k}, []string{list.String()}, []string{"item"}, nil
+	}
+	keyList := make([]string, 0, len(innerList.Items)+1)
+	valueList := make([]string, 0, len(innerList.Items)+1)
+	serializations := make([]string, 0, len(innerList.Items)+1)
+	for i := 0; i <= len(innerList.Items); i++ {
+		prefix := InnerList{Items: innerList.Items[:i], Params: innerList.Params}
+		keyList = append(keyList, fmt.Sprintf("%s:%d", k, i))
+		valueList = append(valueList, prefix.String())
+		serializations = append(serializations, fmt.Sprintf("inner-list prefix %d of %d members", i, len(innerList.Items)))
+	}
+	return keyList, valueList, serializations, nil
+}
+
+func normaliseDictionary(k string, dict Dictionary) ([]string, []string, []string, error) {
+	keyList := make([]string, 0, len(dict))
+	valueList := make([]string, 0, len(dict))
+	serializations := make([]string, 0, len(dict))
+	for _, m := range dict {
+		keyList = append(keyList, fmt.Sprintf("%s:%s", k, m.Key))
+		valueList = append(valueList, sfString(m.Member))
+		serializations = append(serializations, fmt.Sprintf("dictionary member %q", m.Key))
+	}
+	return keyList, valueList, serializations, nil
+}
+
+// sfString serializes the list or dictionary member.
+func sfString(m Member) string {
+	b := new(strings.Builder)
+	m.serialize(b)
+	return b.String()
+}
+
+func allowedForKey(n byte) bool {
+	return n == '_' || n == '-' || n == '.' || n == '*' || (n >= 'a' && n <= 'z') || (n >= '0' && n <= '9')
 }
@@ -0,0 +1,76 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*
+This profile follows https://www.rfc-editor.org/rfc/rfc9421 */
+
+const rfc9421ProfileName = "rfc9421"
+
+// RFC9421Profile signs the header fields with their raw values and derives
+// @method, @authority, @target-uri, @path and @query as defined by RFC 9421.
+type RFC9421Profile struct{}
+
+func (RFC9421Profile) Name() string {
+	return rfc9421ProfileName
+}
+
+func (RFC9421Profile) Version() string {
+	return ""
+}
+
+func (RFC9421Profile) AppendHeader(m *Material, k string, v []string) error {
+	name := strings.ToLower(strings.TrimSpace(k))
+	for i := range name {
+		if !allowedForKey(name[i]) {
+			return errors.Wrap(ErrWrongKeySymbol, name)
+		}
+	}
+	trimmed := make([]string, len(v))
+	for i := range v {
+		trimmed[i] = strings.TrimSpace(v[i])
+	}
+	m.AppendValue(name, strings.Join(trimmed, ", "))
+	m.setOrigin(name, componentOrigin{source: k, raw: strings.Join(v, ", "), serialization: "raw field value"})
+	return nil
+}
+
+func (RFC9421Profile) AppendDerived(m *Material, req *http.Request, body []byte) {
+	for _, name := range []string{ietfMethod, ietfAuthority, ietfTargetURI, ietfPath, ietfQuery} {
+		value, _ := DeriveComponent(name, req)
+		m.AppendValue(name, value)
+	}
+	if len(body) > 0 {
+		m.AddContentDigest(body, req.Header)
+	}
+}
+
+func (RFC9421Profile) SignatureParams(m *Material, keyID string) string {
+	return fmt.Sprintf("%s;created=%s;expires=%s;nonce=%q;keyid=%q", QuoteNames(m.Names), m.Created, m.Expires, m.Nonce, keyID)
+}
+
+func (RFC9421Profile) SignatureBase(m *Material, signatureParams string) []byte {
+	return WriteComponents(m, signatureParams)
+}
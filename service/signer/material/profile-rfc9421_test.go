@@ -0,0 +1,68 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRFC9421Profile(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "https://Example.com:443/foo?param=Value&Pet=dog", strings.NewReader(`{"hello": "world"}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header["Accept"] = []string{" text/html ", "application/json;q=0.9"}
+
+	m, err := MaterialFromRequest(req, &Options{Profile: RFC9421Profile{}})
+	require.NoError(t, err)
+	m.Created, m.Expires, m.Nonce = "1618884473", "1618884773", "b3k2pp5k7z"
+
+	assert.Equal(t, "POST", m.Data["@method"])
+	assert.Equal(t, "example.com", m.Data["@authority"])
+	assert.Equal(t, "https://example.com:443/foo?param=Value&Pet=dog", m.Data["@target-uri"])
+	assert.Equal(t, "/foo", m.Data["@path"])
+	assert.Equal(t, "?param=Value&Pet=dog", m.Data["@query"])
+	assert.Equal(t, "text/html, application/json;q=0.9", m.Data["accept"])
+	assert.Equal(t, "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:", m.Data["content-digest"])
+
+	m.Names = []Component{{Name: "@method"}, {Name: "@authority"}, {Name: "@query"}}
+	base, params, err := m.GetBody("test-key")
+	require.NoError(t, err)
+	assert.Equal(t, `("@method" "@authority" "@query");created=1618884473;expires=1618884773;nonce="b3k2pp5k7z";keyid="test-key"`, params)
+	assert.Equal(t, `"@method": POST
+"@authority": example.com
+"@query": ?param=Value&Pet=dog
+"@signature-params": `+params, string(base))
+	assert.Empty(t, RFC9421Profile{}.Version())
+}
+
+func TestRFC9421Profile_EmptyQuery(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:3000", nil)
+	require.NoError(t, err)
+
+	m, err := MaterialFromRequest(req, &Options{Profile: RFC9421Profile{}})
+	require.NoError(t, err)
+	assert.Equal(t, "/", m.Data["@path"])
+	assert.Equal(t, "?", m.Data["@query"])
+	assert.Equal(t, "localhost:3000", m.Data["@authority"])
+	_, ok := m.Data["content-digest"]
+	assert.False(t, ok)
+}
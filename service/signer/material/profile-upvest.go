@@ -0,0 +1,73 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const upvestV15ProfileName = "upvest-v15"
+
+// UpvestV15Profile is the draft based signature format of the Upvest signature version 15.
+// Structured header values are normalised and expanded to the `name:key` components.
+type UpvestV15Profile struct{}
+
+func (UpvestV15Profile) Name() string {
+	return upvestV15ProfileName
+}
+
+func (UpvestV15Profile) Version() string {
+	return "15"
+}
+
+func (UpvestV15Profile) AppendHeader(m *Material, k string, v []string) error {
+	nk, nv, serializations, err := normalise(k, v)
+	if err != nil {
+		return errors.Wrap(err, "normalisation error")
+	}
+	raw := strings.Join(v, ", ")
+	for i := 0; i < len(nk); i++ {
+		m.AppendValue(nk[i], nv[i])
+		m.setOrigin(nk[i], componentOrigin{source: k, raw: raw, serialization: serializations[i]})
+	}
+	return nil
+}
+
+func (UpvestV15Profile) AppendDerived(m *Material, req *http.Request, body []byte) {
+	m.AppendValue(ietfMethod, req.Method)
+	if len(req.URL.Path) > 0 {
+		m.AppendValue(ietfPath, req.URL.Path)
+	}
+	if len(body) > 0 {
+		m.AddContentDigest(body, req.Header)
+	}
+	if len(req.URL.RawQuery) > 0 {
+		m.AppendValue(ietfQuery, "?"+req.URL.RawQuery)
+	}
+}
+
+func (UpvestV15Profile) SignatureParams(m *Material, keyID string) string {
+	return fmt.Sprintf("%s;keyid=%q;created=%s;nonce=%q;expires=%s", QuoteNames(m.Names), keyID, m.Created, m.Nonce, m.Expires)
+}
+
+func (UpvestV15Profile) SignatureBase(m *Material, signatureParams string) []byte {
+	return WriteComponents(m, signatureParams)
+}
@@ -0,0 +1,110 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Profile decides which components of a request are signed and how the signature base is serialized.
+// New signature versions are added by registering a new Profile with RegisterProfile.
+type Profile interface {
+	// Name is used to select the profile in the key configuration.
+	Name() string
+	// Version is sent in the Upvest-Signature-Version header, the header is omitted when it is empty.
+	Version() string
+	// AppendHeader adds the header field to the material as one or more components.
+	AppendHeader(m *Material, name string, values []string) error
+	// AppendDerived adds the derived components and the content digest of the request.
+	AppendDerived(m *Material, req *http.Request, body []byte)
+	// SignatureParams serializes the value of the @signature-params component.
+	SignatureParams(m *Material, keyID string) string
+	// SignatureBase serializes the signature base for the given @signature-params value.
+	SignatureBase(m *Material, signatureParams string) []byte
+}
+
+const DefaultProfileName = upvestV15ProfileName
+
+var ErrUnknownProfile = errors.New("unknown signing profile")
+
+var (
+	profilesLock = new(sync.RWMutex)
+	profiles     = map[string]Profile{}
+)
+
+func init() {
+	RegisterProfile(UpvestV15Profile{})
+	RegisterProfile(RFC9421Profile{})
+}
+
+// RegisterProfile makes the profile available by its name, an existing profile with the same name is replaced.
+func RegisterProfile(p Profile) {
+	profilesLock.Lock()
+	profiles[p.Name()] = p
+	profilesLock.Unlock()
+}
+
+// GetProfile returns the registered profile, the empty name selects the default profile.
+func GetProfile(name string) (Profile, error) {
+	if name == "" {
+		name = DefaultProfileName
+	}
+	profilesLock.RLock()
+	p, ok := profiles[name]
+	profilesLock.RUnlock()
+	if !ok {
+		return nil, errors.WithMessagef(ErrUnknownProfile, "%s, known profiles: %s", name, strings.Join(ProfileNames(), ", "))
+	}
+	return p, nil
+}
+
+func ProfileNames() []string {
+	profilesLock.RLock()
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	profilesLock.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// WriteComponents writes the `"name": value` lines of the material components followed by the @signature-params line.
+func WriteComponents(m *Material, signatureParams string) []byte {
+	buf := new(bytes.Buffer)
+	for _, c := range m.Names {
+		buf.WriteString(c.Identifier() + ": " + m.Data[c.String()])
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(Format(ietfSignatureParams, signatureParams))
+	return buf.Bytes()
+}
+
+// QuoteNames serializes the component identifiers as the inner list of the @signature-params.
+func QuoteNames(names []Component) string {
+	identifiers := make([]string, len(names))
+	for i, c := range names {
+		identifiers[i] = c.Identifier()
+	}
+	return "(" + strings.Join(identifiers, " ") + ")"
+}
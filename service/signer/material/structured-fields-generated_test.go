@@ -0,0 +1,235 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// generatedSFTests generates the cases of the *-generated.json files of the upstream suite: every ASCII
+// character in and starting the keys, strings and tokens, the digit counts of the numbers and the large values.
+func generatedSFTests(t testing.TB) map[string][]sfTest {
+	g := &sfGenerator{t: t, tests: make(map[string][]sfTest)}
+	g.keys()
+	g.strings()
+	g.tokens()
+	g.numbers()
+	g.large()
+	return g.tests
+}
+
+type sfGenerator struct {
+	t     testing.TB
+	tests map[string][]sfTest
+}
+
+func (g *sfGenerator) add(file string, tt sfTest) {
+	g.tests[file] = append(g.tests[file], tt)
+}
+
+// valid adds a parsing case, the canonical serialization is the raw value without a canonical one.
+func (g *sfGenerator) valid(file, name, headerType, raw string, expected interface{}, canonical ...string) {
+	data, err := json.Marshal(expected)
+	require.NoError(g.t, err)
+	g.add(file, sfTest{Name: name, Raw: []string{raw}, HeaderType: headerType, Expected: data, Canonical: canonical})
+}
+
+func (g *sfGenerator) invalid(file, name, headerType, raw string) {
+	g.add(file, sfTest{Name: name, Raw: []string{raw}, HeaderType: headerType, MustFail: true})
+}
+
+// unserializable adds a serialisation case of a value which fails to serialize.
+func (g *sfGenerator) unserializable(file, name, headerType string, expected interface{}) {
+	data, err := json.Marshal(expected)
+	require.NoError(g.t, err)
+	g.add("serialisation-tests/"+file, sfTest{Name: name, HeaderType: headerType, Expected: data, MustFail: true})
+}
+
+func sfToken(v string) map[string]string {
+	return map[string]string{"__type": "token", "value": v}
+}
+
+func sfItem(v interface{}, params ...interface{}) []interface{} {
+	return []interface{}{v, append([]interface{}{}, params...)}
+}
+
+func (g *sfGenerator) keys() {
+	const file = "key-generated.json"
+	for i := 0; i < 0x80; i++ {
+		c := string(rune(i))
+		key := "a" + c + "a"
+		name := fmt.Sprintf("0x%02x in dictionary key", i)
+		switch {
+		case isKeyChar(byte(i)):
+			g.valid(file, name, "dictionary", key+"=1", []interface{}{[]interface{}{key, sfItem(1)}})
+		case c == ",":
+			g.valid(file, name, "dictionary", key+"=1", []interface{}{[]interface{}{"a", sfItem(1)}}, "a=1")
+		case c == ";":
+			g.valid(file, name, "dictionary", key+"=1", []interface{}{[]interface{}{"a", sfItem(true, []interface{}{"a", 1})}})
+		default:
+			g.invalid(file, name, "dictionary", key+"=1")
+			g.unserializable(file, name, "dictionary", []interface{}{[]interface{}{key, sfItem(1)}})
+		}
+
+		key = c + "a"
+		name = fmt.Sprintf("0x%02x starting a dictionary key", i)
+		switch {
+		case isLCAlpha(byte(i)) || c == "*":
+			g.valid(file, name, "dictionary", key+"=1", []interface{}{[]interface{}{key, sfItem(1)}})
+		case c == " ":
+			g.valid(file, name, "dictionary", key+"=1", []interface{}{[]interface{}{"a", sfItem(1)}}, "a=1")
+		default:
+			g.invalid(file, name, "dictionary", key+"=1")
+			g.unserializable(file, name, "dictionary", []interface{}{[]interface{}{key, sfItem(1)}})
+		}
+
+		key = "a" + c + "a"
+		name = fmt.Sprintf("0x%02x in parameterised list key", i)
+		switch {
+		case isKeyChar(byte(i)):
+			g.valid(file, name, "list", "foo; "+key+"=1", []interface{}{sfItem(sfToken("foo"), []interface{}{key, 1})}, "foo;"+key+"=1")
+		case c == ";":
+			g.valid(file, name, "list", "foo; "+key+"=1", []interface{}{sfItem(sfToken("foo"), []interface{}{"a", 1})}, "foo;a=1")
+		default:
+			g.invalid(file, name, "list", "foo; "+key+"=1")
+			g.unserializable(file, name, "list", []interface{}{sfItem(sfToken("foo"), []interface{}{key, 1})})
+		}
+
+		key = c + "a"
+		name = fmt.Sprintf("0x%02x starting a parameterised list key", i)
+		switch {
+		case isLCAlpha(byte(i)) || c == "*":
+			g.valid(file, name, "list", "foo; "+key+"=1", []interface{}{sfItem(sfToken("foo"), []interface{}{key, 1})}, "foo;"+key+"=1")
+		case c == " ":
+			g.valid(file, name, "list", "foo; "+key+"=1", []interface{}{sfItem(sfToken("foo"), []interface{}{"a", 1})}, "foo;a=1")
+		default:
+			g.invalid(file, name, "list", "foo; "+key+"=1")
+			g.unserializable(file, name, "list", []interface{}{sfItem(sfToken("foo"), []interface{}{key, 1})})
+		}
+	}
+}
+
+func (g *sfGenerator) strings() {
+	const file = "string-generated.json"
+	for i := 0; i < 0x80; i++ {
+		c := string(rune(i))
+		name := fmt.Sprintf("0x%02x in string", i)
+		switch {
+		case i >= 0x20 && i <= 0x7e && c != `"` && c != `\`:
+			g.valid(file, name, "item", `"`+c+`"`, sfItem(c))
+		default:
+			g.invalid(file, name, "item", `"`+c+`"`)
+		}
+		if i < 0x20 || i > 0x7e {
+			g.unserializable(file, name, "item", sfItem(c))
+		}
+
+		name = fmt.Sprintf("Escaped 0x%02x in string", i)
+		if c == `"` || c == `\` {
+			g.valid(file, name, "item", `"\`+c+`"`, sfItem(c))
+		} else {
+			g.invalid(file, name, "item", `"\`+c+`"`)
+		}
+	}
+}
+
+func (g *sfGenerator) tokens() {
+	const file = "token-generated.json"
+	for i := 0; i < 0x80; i++ {
+		c := string(rune(i))
+		token := "a" + c + "a"
+		name := fmt.Sprintf("0x%02x in token", i)
+		switch {
+		case isTChar(byte(i)) || c == ":" || c == "/":
+			g.valid(file, name, "item", token, sfItem(sfToken(token)))
+		case c == ";":
+			g.valid(file, name, "item", token, sfItem(sfToken("a"), []interface{}{"a", true}))
+		default:
+			g.invalid(file, name, "item", token)
+			g.unserializable(file, name, "item", sfItem(sfToken(token)))
+		}
+
+		token = c + "a"
+		name = fmt.Sprintf("0x%02x starting a token", i)
+		switch {
+		case isAlpha(byte(i)) || c == "*":
+			g.valid(file, name, "item", token, sfItem(sfToken(token)))
+		case c == " ":
+			g.valid(file, name, "item", token, sfItem(sfToken("a")), "a")
+		default:
+			g.invalid(file, name, "item", token)
+			g.unserializable(file, name, "item", sfItem(sfToken(token)))
+		}
+	}
+}
+
+func (g *sfGenerator) numbers() {
+	const file = "number-generated.json"
+	for i := 1; i <= 16; i++ {
+		for _, sign := range []string{"", "-"} {
+			raw := sign + strings.Repeat("1", i)
+			name := fmt.Sprintf("%d digits of %s1 integer", i, sign)
+			if i <= 15 {
+				g.valid(file, name, "item", raw, sfItem(json.Number(raw)))
+			} else {
+				g.invalid(file, name, "item", raw)
+				g.unserializable(file, name, "item", sfItem(json.Number(raw)))
+			}
+		}
+		for j := 1; j <= 4; j++ {
+			raw := strings.Repeat("1", i) + "." + strings.Repeat("1", j)
+			name := fmt.Sprintf("decimal with %d integer and %d fractional digits", i, j)
+			if i <= 12 && j <= 3 {
+				g.valid(file, name, "item", raw, sfItem(json.Number(raw)))
+			} else {
+				g.invalid(file, name, "item", raw)
+			}
+			if i > 12 {
+				g.unserializable(file, name, "item", sfItem(json.Number(raw)))
+			}
+		}
+	}
+}
+
+func (g *sfGenerator) large() {
+	const file = "large-generated.json"
+	var raw []string
+	var list, dict, params []interface{}
+	for i := 0; i < 1024; i++ {
+		key := fmt.Sprintf("a%d", i)
+		raw = append(raw, key)
+		list = append(list, sfItem(sfToken(key)))
+		dict = append(dict, []interface{}{key, sfItem(1)})
+		params = append(params, []interface{}{key, 1})
+	}
+	g.valid(file, "large list", "list", strings.Join(raw, ", "), list)
+	g.valid(file, "large dictionary", "dictionary", strings.Join(raw, "=1, ")+"=1", dict)
+	g.valid(file, "large parameters", "item", "foo;"+strings.Join(raw[:256], "=1;")+"=1", sfItem(sfToken("foo"), params[:256]...))
+	g.valid(file, "large inner list", "list", "("+strings.Join(raw[:256], " ")+")", []interface{}{[]interface{}{list[:256], []interface{}{}}})
+
+	key := strings.Repeat("a", 64)
+	g.valid(file, "long dictionary key", "dictionary", key+"=1", []interface{}{[]interface{}{key, sfItem(1)}})
+	g.valid(file, "long parameter key", "item", "foo;"+key+"=1", sfItem(sfToken("foo"), []interface{}{key, 1}))
+	value := strings.Repeat("a", 1024)
+	g.valid(file, "long string", "item", `"`+value+`"`, sfItem(value))
+	g.valid(file, "long token", "item", value[:512], sfItem(sfToken(value[:512])))
+}
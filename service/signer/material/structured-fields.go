@@ -0,0 +1,797 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	b64 "encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+/*
+Structured Field Values for HTTP, https://www.rfc-editor.org/rfc/rfc9651 (formerly RFC 8941)
+
+The bare items are int64 integers, Decimal, string, Token, []byte byte sequences, bool, Date and DisplayString.
+*/
+
+var ErrInvalidStructuredField = errors.New("invalid structured field")
+
+// Token is a token bare item, it is serialized without the quotes of a string.
+type Token string
+
+// Decimal is a decimal bare item in thousandths, the precision of RFC 8941 decimals.
+type Decimal int64
+
+func (d Decimal) Float() float64 {
+	return float64(d) / 1000
+}
+
+// Date is a date bare item in seconds since the Unix epoch.
+type Date int64
+
+// DisplayString is a display string bare item, the Unicode text is percent-encoded in the field.
+type DisplayString string
+
+// maxSFInteger is the largest absolute value of an integer, 15 digits.
+const maxSFInteger = 999999999999999
+
+// Param is a parameter of an item or an inner list.
+type Param struct {
+	Key   string
+	Value interface{}
+}
+
+// Params are the parameters in their order.
+type Params []Param
+
+// Get returns the value of the parameter.
+func (p Params) Get(key string) (interface{}, bool) {
+	for _, param := range p {
+		if param.Key == key {
+			return param.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Member is a member of a list or a dictionary, an Item or an InnerList.
+type Member interface {
+	serialize(b *strings.Builder)
+}
+
+// Item is a bare item with parameters.
+type Item struct {
+	Value  interface{}
+	Params Params
+}
+
+// InnerList is a parenthesised list of items with parameters.
+type InnerList struct {
+	Items  []Item
+	Params Params
+}
+
+// List is a list field value.
+type List []Member
+
+// DictMember is a member of a dictionary.
+type DictMember struct {
+	Key    string
+	Member Member
+}
+
+// Dictionary is a dictionary field value with the members in their order.
+type Dictionary []DictMember
+
+// Get returns the member of the dictionary.
+func (d Dictionary) Get(key string) (Member, bool) {
+	for _, m := range d {
+		if m.Key == key {
+			return m.Member, true
+		}
+	}
+	return nil, false
+}
+
+// ParseList parses the field value as a list.
+func ParseList(value string) (List, error) {
+	p, err := newSFParser(value)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	return res, p.end()
+}
+
+// ParseDictionary parses the field value as a dictionary.
+func ParseDictionary(value string) (Dictionary, error) {
+	p, err := newSFParser(value)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.parseDictionary()
+	if err != nil {
+		return nil, err
+	}
+	return res, p.end()
+}
+
+// ParseItem parses the field value as an item.
+func ParseItem(value string) (Item, error) {
+	p, err := newSFParser(value)
+	if err != nil {
+		return Item{}, err
+	}
+	res, err := p.parseItem()
+	if err != nil {
+		return Item{}, err
+	}
+	return res, p.end()
+}
+
+type sfParser struct {
+	src string
+	pos int
+}
+
+func newSFParser(value string) (*sfParser, error) {
+	for i := 0; i < len(value); i++ {
+		if value[i] > 0x7f {
+			return nil, sfError(value, i, "not ASCII")
+		}
+	}
+	p := &sfParser{src: value}
+	p.skipSP()
+	return p, nil
+}
+
+func sfError(src string, pos int, msg string) error {
+	return errors.WithMessagef(ErrInvalidStructuredField, "%s at %d of %q", msg, pos, src)
+}
+
+func (p *sfParser) fail(msg string) error {
+	return sfError(p.src, p.pos, msg)
+}
+
+func (p *sfParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *sfParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *sfParser) skipSP() {
+	for !p.eof() && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *sfParser) skipOWS() {
+	for !p.eof() && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *sfParser) end() error {
+	p.skipSP()
+	if !p.eof() {
+		return p.fail("unexpected character")
+	}
+	return nil
+}
+
+func (p *sfParser) parseList() (List, error) {
+	res := List{}
+	for !p.eof() {
+		member, err := p.parseItemOrInnerList()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, member)
+		if p.skipOWS(); p.eof() {
+			return res, nil
+		}
+		if p.peek() != ',' {
+			return nil, p.fail("expected comma")
+		}
+		p.pos++
+		if p.skipOWS(); p.eof() {
+			return nil, p.fail("trailing comma")
+		}
+	}
+	return res, nil
+}
+
+func (p *sfParser) parseDictionary() (Dictionary, error) {
+	res := Dictionary{}
+	for !p.eof() {
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		var member Member
+		if p.peek() == '=' {
+			p.pos++
+			if member, err = p.parseItemOrInnerList(); err != nil {
+				return nil, err
+			}
+		} else {
+			params, err := p.parseParams()
+			if err != nil {
+				return nil, err
+			}
+			member = Item{Value: true, Params: params}
+		}
+		res = res.set(key, member)
+		if p.skipOWS(); p.eof() {
+			return res, nil
+		}
+		if p.peek() != ',' {
+			return nil, p.fail("expected comma")
+		}
+		p.pos++
+		if p.skipOWS(); p.eof() {
+			return nil, p.fail("trailing comma")
+		}
+	}
+	return res, nil
+}
+
+// set overwrites the value of a duplicated key in its first position.
+func (d Dictionary) set(key string, member Member) Dictionary {
+	for i := range d {
+		if d[i].Key == key {
+			d[i].Member = member
+			return d
+		}
+	}
+	return append(d, DictMember{Key: key, Member: member})
+}
+
+func (p *sfParser) parseItemOrInnerList() (Member, error) {
+	if p.peek() == '(' {
+		return p.parseInnerList()
+	}
+	return p.parseItem()
+}
+
+func (p *sfParser) parseInnerList() (InnerList, error) {
+	p.pos++
+	res := InnerList{Items: []Item{}}
+	for !p.eof() {
+		p.skipSP()
+		if p.peek() == ')' {
+			p.pos++
+			params, err := p.parseParams()
+			if err != nil {
+				return InnerList{}, err
+			}
+			res.Params = params
+			return res, nil
+		}
+		item, err := p.parseItem()
+		if err != nil {
+			return InnerList{}, err
+		}
+		res.Items = append(res.Items, item)
+		if c := p.peek(); c != ' ' && c != ')' {
+			return InnerList{}, p.fail("expected space or end of inner list")
+		}
+	}
+	return InnerList{}, p.fail("unterminated inner list")
+}
+
+func (p *sfParser) parseItem() (Item, error) {
+	value, err := p.parseBareItem()
+	if err != nil {
+		return Item{}, err
+	}
+	params, err := p.parseParams()
+	if err != nil {
+		return Item{}, err
+	}
+	return Item{Value: value, Params: params}, nil
+}
+
+func (p *sfParser) parseParams() (Params, error) {
+	res := Params{}
+	for p.peek() == ';' {
+		p.pos++
+		p.skipSP()
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		var value interface{} = true
+		if p.peek() == '=' {
+			p.pos++
+			if value, err = p.parseBareItem(); err != nil {
+				return nil, err
+			}
+		}
+		res = res.set(key, value)
+	}
+	return res, nil
+}
+
+// set overwrites the value of a duplicated key in its first position.
+func (p Params) set(key string, value interface{}) Params {
+	for i := range p {
+		if p[i].Key == key {
+			p[i].Value = value
+			return p
+		}
+	}
+	return append(p, Param{Key: key, Value: value})
+}
+
+func (p *sfParser) parseKey() (string, error) {
+	if c := p.peek(); !isLCAlpha(c) && c != '*' {
+		return "", p.fail("expected key")
+	}
+	start := p.pos
+	for !p.eof() && isKeyChar(p.peek()) {
+		p.pos++
+	}
+	return p.src[start:p.pos], nil
+}
+
+func (p *sfParser) parseBareItem() (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '-' || isDigit(c):
+		return p.parseNumber()
+	case c == '"':
+		return p.parseString()
+	case c == '*' || isAlpha(c):
+		return p.parseToken(), nil
+	case c == ':':
+		return p.parseByteSequence()
+	case c == '?':
+		return p.parseBoolean()
+	case c == '@':
+		return p.parseDate()
+	case c == '%':
+		return p.parseDisplayString()
+	}
+	return nil, p.fail("unexpected start of item")
+}
+
+func (p *sfParser) parseNumber() (interface{}, error) {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	if !isDigit(p.peek()) {
+		return nil, p.fail("expected digit")
+	}
+	digits := p.pos
+	dot := -1
+	for !p.eof() {
+		c := p.peek()
+		if isDigit(c) {
+			p.pos++
+		} else if c == '.' && dot < 0 {
+			if p.pos-digits > 12 {
+				return nil, p.fail("too many integer digits of decimal")
+			}
+			dot = p.pos
+			p.pos++
+		} else {
+			break
+		}
+		if dot < 0 && p.pos-digits > 15 {
+			return nil, p.fail("too many digits of integer")
+		}
+		if dot >= 0 && p.pos-digits > 16 {
+			return nil, p.fail("too many digits of decimal")
+		}
+	}
+	num := p.src[start:p.pos]
+	if dot < 0 {
+		v, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return nil, p.fail("invalid integer")
+		}
+		return v, nil
+	}
+	fraction := p.pos - dot - 1
+	if fraction == 0 || fraction > 3 {
+		return nil, p.fail("invalid decimal fraction")
+	}
+	v, err := strconv.ParseInt(strings.Replace(num, ".", "", 1)+strings.Repeat("0", 3-fraction), 10, 64)
+	if err != nil {
+		return nil, p.fail("invalid decimal")
+	}
+	return Decimal(v), nil
+}
+
+func (p *sfParser) parseString() (string, error) {
+	p.pos++
+	b := new(strings.Builder)
+	for !p.eof() {
+		c := p.src[p.pos]
+		p.pos++
+		switch {
+		case c == '\\':
+			if p.eof() {
+				return "", p.fail("unterminated escape")
+			}
+			if next := p.src[p.pos]; next == '"' || next == '\\' {
+				b.WriteByte(next)
+				p.pos++
+				continue
+			}
+			return "", p.fail("invalid escape")
+		case c == '"':
+			return b.String(), nil
+		case c < 0x20 || c > 0x7e:
+			return "", p.fail("invalid string character")
+		}
+		b.WriteByte(c)
+	}
+	return "", p.fail("unterminated string")
+}
+
+func (p *sfParser) parseToken() Token {
+	start := p.pos
+	for !p.eof() && (isTChar(p.peek()) || p.peek() == ':' || p.peek() == '/') {
+		p.pos++
+	}
+	return Token(p.src[start:p.pos])
+}
+
+func (p *sfParser) parseByteSequence() ([]byte, error) {
+	p.pos++
+	end := strings.IndexByte(p.src[p.pos:], ':')
+	if end < 0 {
+		return nil, p.fail("unterminated byte sequence")
+	}
+	encoded := p.src[p.pos : p.pos+end]
+	for i := 0; i < len(encoded); i++ {
+		if c := encoded[i]; !isAlpha(c) && !isDigit(c) && c != '+' && c != '/' && c != '=' {
+			return nil, p.fail("invalid byte sequence character")
+		}
+	}
+	p.pos += end + 1
+	v, err := b64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		// the padding is optional for the parsers
+		if v, err = b64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "=")); err != nil {
+			return nil, p.fail("invalid base64")
+		}
+	}
+	return v, nil
+}
+
+func (p *sfParser) parseBoolean() (bool, error) {
+	p.pos++
+	switch p.peek() {
+	case '1':
+		p.pos++
+		return true, nil
+	case '0':
+		p.pos++
+		return false, nil
+	}
+	return false, p.fail("invalid boolean")
+}
+
+func (p *sfParser) parseDate() (Date, error) {
+	p.pos++
+	v, err := p.parseNumber()
+	if err != nil {
+		return 0, err
+	}
+	date, ok := v.(int64)
+	if !ok {
+		return 0, p.fail("decimal date")
+	}
+	return Date(date), nil
+}
+
+func (p *sfParser) parseDisplayString() (DisplayString, error) {
+	p.pos++
+	if p.peek() != '"' {
+		return "", p.fail("expected quote of display string")
+	}
+	p.pos++
+	b := new(strings.Builder)
+	for !p.eof() {
+		c := p.src[p.pos]
+		p.pos++
+		switch {
+		case c < 0x20 || c > 0x7e:
+			return "", p.fail("invalid display string character")
+		case c == '%':
+			if p.pos+2 > len(p.src) || !isLCHex(p.src[p.pos]) || !isLCHex(p.src[p.pos+1]) {
+				return "", p.fail("invalid percent-encoding")
+			}
+			octet, _ := hex.DecodeString(p.src[p.pos : p.pos+2])
+			b.Write(octet)
+			p.pos += 2
+			continue
+		case c == '"':
+			if !utf8.ValidString(b.String()) {
+				return "", p.fail("invalid UTF-8 in display string")
+			}
+			return DisplayString(b.String()), nil
+		}
+		b.WriteByte(c)
+	}
+	return "", p.fail("unterminated display string")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLCAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+func isLCHex(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f')
+}
+
+func isAlpha(c byte) bool {
+	return isLCAlpha(c) || (c >= 'A' && c <= 'Z')
+}
+
+func isKeyChar(c byte) bool {
+	return isLCAlpha(c) || isDigit(c) || c == '_' || c == '-' || c == '.' || c == '*'
+}
+
+func isTChar(c byte) bool {
+	return isAlpha(c) || isDigit(c) || strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+func (i Item) String() string {
+	b := new(strings.Builder)
+	i.serialize(b)
+	return b.String()
+}
+
+func (l InnerList) String() string {
+	b := new(strings.Builder)
+	l.serialize(b)
+	return b.String()
+}
+
+func (l List) String() string {
+	b := new(strings.Builder)
+	for i, member := range l {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		member.serialize(b)
+	}
+	return b.String()
+}
+
+func (d Dictionary) String() string {
+	b := new(strings.Builder)
+	for i, m := range d {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(m.Key)
+		if item, ok := m.Member.(Item); ok && item.Value == true {
+			item.Params.serialize(b)
+			continue
+		}
+		b.WriteByte('=')
+		m.Member.serialize(b)
+	}
+	return b.String()
+}
+
+func (i Item) serialize(b *strings.Builder) {
+	serializeBareItem(b, i.Value)
+	i.Params.serialize(b)
+}
+
+func (l InnerList) serialize(b *strings.Builder) {
+	b.WriteByte('(')
+	for i, item := range l.Items {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		item.serialize(b)
+	}
+	b.WriteByte(')')
+	l.Params.serialize(b)
+}
+
+func (p Params) serialize(b *strings.Builder) {
+	for _, param := range p {
+		b.WriteByte(';')
+		b.WriteString(param.Key)
+		if param.Value != true {
+			b.WriteByte('=')
+			serializeBareItem(b, param.Value)
+		}
+	}
+}
+
+// serializeBareItem writes the bare item, the values are expected to be valid, as the parsed ones are.
+func serializeBareItem(b *strings.Builder, v interface{}) {
+	switch v := v.(type) {
+	case int64:
+		b.WriteString(strconv.FormatInt(v, 10))
+	case int:
+		b.WriteString(strconv.Itoa(v))
+	case Decimal:
+		if v < 0 {
+			b.WriteByte('-')
+			v = -v
+		}
+		b.WriteString(strconv.FormatInt(int64(v/1000), 10))
+		b.WriteByte('.')
+		fraction := strings.TrimRight(strconv.FormatInt(int64(v%1000)+1000, 10)[1:], "0")
+		if fraction == "" {
+			fraction = "0"
+		}
+		b.WriteString(fraction)
+	case string:
+		b.WriteByte('"')
+		for i := 0; i < len(v); i++ {
+			if v[i] == '"' || v[i] == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(v[i])
+		}
+		b.WriteByte('"')
+	case Token:
+		b.WriteString(string(v))
+	case []byte:
+		b.WriteByte(':')
+		b.WriteString(b64.StdEncoding.EncodeToString(v))
+		b.WriteByte(':')
+	case bool:
+		if v {
+			b.WriteString("?1")
+		} else {
+			b.WriteString("?0")
+		}
+	case Date:
+		b.WriteByte('@')
+		b.WriteString(strconv.FormatInt(int64(v), 10))
+	case DisplayString:
+		b.WriteString(`%"`)
+		for i := 0; i < len(v); i++ {
+			if c := v[i]; c == '%' || c == '"' || c < 0x20 || c > 0x7e {
+				b.WriteByte('%')
+				b.WriteString(hex.EncodeToString([]byte{c}))
+			} else {
+				b.WriteByte(c)
+			}
+		}
+		b.WriteByte('"')
+	}
+}
+
+// validateSF checks that the List, Dictionary, Item or InnerList can be serialized, String expects the
+// values to be valid, as the parsed ones are, and writes the invalid ones which the RFC fails to serialize.
+func validateSF(v interface{}) error {
+	switch v := v.(type) {
+	case List:
+		for _, member := range v {
+			if err := validateSF(member); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Dictionary:
+		for _, m := range v {
+			if err := validateKey(m.Key); err != nil {
+				return err
+			}
+			if err := validateSF(m.Member); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Item:
+		if err := validateBareItem(v.Value); err != nil {
+			return err
+		}
+		return validateParams(v.Params)
+	case InnerList:
+		for _, item := range v.Items {
+			if err := validateSF(item); err != nil {
+				return err
+			}
+		}
+		return validateParams(v.Params)
+	}
+	return errors.WithMessagef(ErrInvalidStructuredField, "unsupported value %T", v)
+}
+
+func validateParams(params Params) error {
+	for _, param := range params {
+		if err := validateKey(param.Key); err != nil {
+			return err
+		}
+		if err := validateBareItem(param.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateKey(key string) error {
+	if key == "" || (!isLCAlpha(key[0]) && key[0] != '*') {
+		return errors.WithMessagef(ErrInvalidStructuredField, "invalid key %q", key)
+	}
+	for i := 1; i < len(key); i++ {
+		if !isKeyChar(key[i]) {
+			return errors.WithMessagef(ErrInvalidStructuredField, "invalid key %q", key)
+		}
+	}
+	return nil
+}
+
+func validateBareItem(v interface{}) error {
+	switch v := v.(type) {
+	case int64:
+		if v < -maxSFInteger || v > maxSFInteger {
+			return errors.WithMessagef(ErrInvalidStructuredField, "integer %d out of range", v)
+		}
+	case int:
+		return validateBareItem(int64(v))
+	case Decimal:
+		if v < -maxSFInteger || v > maxSFInteger {
+			return errors.WithMessagef(ErrInvalidStructuredField, "decimal %v out of range", v.Float())
+		}
+	case string:
+		for i := 0; i < len(v); i++ {
+			if v[i] < 0x20 || v[i] > 0x7e {
+				return errors.WithMessagef(ErrInvalidStructuredField, "invalid string character %#x", v[i])
+			}
+		}
+	case Token:
+		if v == "" || (!isAlpha(v[0]) && v[0] != '*') {
+			return errors.WithMessagef(ErrInvalidStructuredField, "invalid token %q", v)
+		}
+		for i := 1; i < len(v); i++ {
+			if !isTChar(v[i]) && v[i] != ':' && v[i] != '/' {
+				return errors.WithMessagef(ErrInvalidStructuredField, "invalid token %q", v)
+			}
+		}
+	case []byte, bool:
+	case Date:
+		return validateBareItem(int64(v))
+	case DisplayString:
+		if !utf8.ValidString(string(v)) {
+			return errors.WithMessagef(ErrInvalidStructuredField, "invalid UTF-8 in display string %q", v)
+		}
+	default:
+		return errors.WithMessagef(ErrInvalidStructuredField, "unsupported bare item %T", v)
+	}
+	return nil
+}
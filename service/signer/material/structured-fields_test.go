@@ -0,0 +1,391 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package material
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// sfTestsDir has the hand-picked cases in the format of the upstream suite.
+	sfTestsDir = "testdata/structured-fields"
+	// sfUpstreamDir has https://github.com/httpwg/structured-field-tests, vendored by make structured-field-tests.
+	sfUpstreamDir = "testdata/structured-field-tests"
+)
+
+// sfTest is a structured field test case in the JSON format of https://github.com/httpwg/structured-field-tests,
+// the serialisation tests have no raw value.
+type sfTest struct {
+	Name       string          `json:"name"`
+	Raw        []string        `json:"raw"`
+	HeaderType string          `json:"header_type"`
+	Expected   json.RawMessage `json:"expected"`
+	MustFail   bool            `json:"must_fail"`
+	CanFail    bool            `json:"can_fail"`
+	Canonical  []string        `json:"canonical"`
+}
+
+// loadSFTests loads the test files of the directory and of its serialisation-tests.
+func loadSFTests(t testing.TB, dir string) map[string][]sfTest {
+	var files []string
+	for _, pattern := range []string{"*.json", "serialisation-tests/*.json"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		require.NoError(t, err)
+		files = append(files, matches...)
+	}
+	require.NotEmpty(t, files)
+	res := make(map[string][]sfTest)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		var tests []sfTest
+		require.NoError(t, json.Unmarshal(data, &tests), file)
+		name, err := filepath.Rel(dir, file)
+		require.NoError(t, err)
+		res[name] = tests
+	}
+	return res
+}
+
+func parseSF(headerType, value string) (interface{ String() string }, error) {
+	switch headerType {
+	case "list":
+		return ParseList(value)
+	case "dictionary":
+		return ParseDictionary(value)
+	}
+	return ParseItem(value)
+}
+
+func TestStructuredFields(t *testing.T) {
+	runSFTests(t, loadSFTests(t, sfTestsDir))
+	runSFTests(t, generatedSFTests(t))
+}
+
+func TestStructuredFields_Upstream(t *testing.T) {
+	if _, err := os.Stat(sfUpstreamDir); os.IsNotExist(err) {
+		t.Skip("the upstream structured field tests are not vendored, run make structured-field-tests")
+	}
+	runSFTests(t, loadSFTests(t, sfUpstreamDir))
+}
+
+func runSFTests(t *testing.T, files map[string][]sfTest) {
+	for file, tests := range files {
+		for _, tt := range tests {
+			t.Run(file+"/"+tt.Name, func(t *testing.T) {
+				canonical := tt.Raw
+				if tt.Canonical != nil {
+					canonical = tt.Canonical
+				}
+				if tt.Raw == nil {
+					testSFSerialisation(t, tt, canonical)
+					return
+				}
+
+				v, err := parseSF(tt.HeaderType, strings.Join(tt.Raw, ", "))
+				if tt.MustFail {
+					assert.ErrorIs(t, err, ErrInvalidStructuredField)
+					return
+				}
+				if err == nil || !tt.CanFail {
+					require.NoError(t, err)
+					actual, err := json.Marshal(sfJSON(v))
+					require.NoError(t, err)
+					assert.JSONEq(t, string(tt.Expected), string(actual))
+					assert.Equal(t, strings.Join(canonical, ", "), v.String())
+				}
+				testSFSerialisation(t, tt, canonical)
+			})
+		}
+	}
+}
+
+// testSFSerialisation serializes the expected value, which fails for the invalid values of the must_fail cases.
+func testSFSerialisation(t *testing.T, tt sfTest, canonical []string) {
+	if tt.Expected == nil && !tt.MustFail {
+		return
+	}
+	v, err := sfValue(tt.HeaderType, tt.Expected)
+	if err == nil {
+		err = validateSF(v)
+	}
+	if tt.MustFail {
+		assert.Error(t, err)
+		return
+	}
+	require.NoError(t, err)
+	assert.Equal(t, strings.Join(canonical, ", "), v.(interface{ String() string }).String())
+}
+
+// sfJSON converts the parsed value to the JSON representation of the test suite.
+func sfJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case List:
+		res := make([]interface{}, 0, len(v))
+		for _, m := range v {
+			res = append(res, sfJSON(m))
+		}
+		return res
+	case Dictionary:
+		res := make([]interface{}, 0, len(v))
+		for _, m := range v {
+			res = append(res, []interface{}{m.Key, sfJSON(m.Member)})
+		}
+		return res
+	case Item:
+		return []interface{}{sfJSON(v.Value), sfJSON(v.Params)}
+	case InnerList:
+		items := make([]interface{}, 0, len(v.Items))
+		for _, item := range v.Items {
+			items = append(items, sfJSON(item))
+		}
+		return []interface{}{items, sfJSON(v.Params)}
+	case Params:
+		res := make([]interface{}, 0, len(v))
+		for _, p := range v {
+			res = append(res, []interface{}{p.Key, sfJSON(p.Value)})
+		}
+		return res
+	case Decimal:
+		return v.Float()
+	case Token:
+		return map[string]string{"__type": "token", "value": string(v)}
+	case []byte:
+		return map[string]string{"__type": "binary", "value": base32.StdEncoding.EncodeToString(v)}
+	case Date:
+		return map[string]interface{}{"__type": "date", "value": int64(v)}
+	case DisplayString:
+		return map[string]string{"__type": "displaystring", "value": string(v)}
+	}
+	return v
+}
+
+// sfValue converts the JSON representation of the test suite to the value, the inverse of sfJSON.
+func sfValue(headerType string, expected json.RawMessage) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(expected))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	switch headerType {
+	case "list":
+		members, _ := v.([]interface{})
+		res := List{}
+		for _, m := range members {
+			member, err := sfMemberValue(m)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, member)
+		}
+		return res, nil
+	case "dictionary":
+		members, _ := v.([]interface{})
+		res := Dictionary{}
+		for _, m := range members {
+			pair, ok := m.([]interface{})
+			if !ok || len(pair) != 2 {
+				return nil, errors.Errorf("invalid dictionary member %v", m)
+			}
+			key, _ := pair[0].(string)
+			member, err := sfMemberValue(pair[1])
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, DictMember{Key: key, Member: member})
+		}
+		return res, nil
+	}
+	return sfItemValue(v)
+}
+
+func sfMemberValue(v interface{}) (Member, error) {
+	pair, ok := v.([]interface{})
+	if !ok || len(pair) != 2 {
+		return nil, errors.Errorf("invalid member %v", v)
+	}
+	items, ok := pair[0].([]interface{})
+	if !ok {
+		return sfItemValue(v)
+	}
+	res := InnerList{Items: []Item{}}
+	for _, i := range items {
+		item, err := sfItemValue(i)
+		if err != nil {
+			return nil, err
+		}
+		res.Items = append(res.Items, item)
+	}
+	params, err := sfParamsValue(pair[1])
+	if err != nil {
+		return nil, err
+	}
+	res.Params = params
+	return res, nil
+}
+
+func sfItemValue(v interface{}) (Item, error) {
+	pair, ok := v.([]interface{})
+	if !ok || len(pair) != 2 {
+		return Item{}, errors.Errorf("invalid item %v", v)
+	}
+	value, err := sfBareValue(pair[0])
+	if err != nil {
+		return Item{}, err
+	}
+	params, err := sfParamsValue(pair[1])
+	if err != nil {
+		return Item{}, err
+	}
+	return Item{Value: value, Params: params}, nil
+}
+
+func sfParamsValue(v interface{}) (Params, error) {
+	params, _ := v.([]interface{})
+	res := Params{}
+	for _, p := range params {
+		pair, ok := p.([]interface{})
+		if !ok || len(pair) != 2 {
+			return nil, errors.Errorf("invalid parameter %v", p)
+		}
+		key, _ := pair[0].(string)
+		value, err := sfBareValue(pair[1])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, Param{Key: key, Value: value})
+	}
+	return res, nil
+}
+
+func sfBareValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case json.Number:
+		if !strings.ContainsAny(v.String(), ".eE") {
+			return strconv.ParseInt(v.String(), 10, 64)
+		}
+		return sfDecimal(v)
+	case string, bool:
+		return v, nil
+	case map[string]interface{}:
+		switch v["__type"] {
+		case "token":
+			value, _ := v["value"].(string)
+			return Token(value), nil
+		case "binary":
+			value, _ := v["value"].(string)
+			return base32.StdEncoding.DecodeString(value)
+		case "date":
+			value, _ := v["value"].(json.Number)
+			date, err := strconv.ParseInt(value.String(), 10, 64)
+			return Date(date), err
+		case "displaystring":
+			value, _ := v["value"].(string)
+			return DisplayString(value), nil
+		}
+	}
+	return nil, errors.Errorf("unsupported bare item %v", v)
+}
+
+// sfDecimal rounds the number to thousandths, half to even.
+func sfDecimal(n json.Number) (Decimal, error) {
+	r, ok := new(big.Rat).SetString(n.String())
+	if !ok {
+		return 0, errors.Errorf("invalid decimal %s", n)
+	}
+	r.Mul(r, big.NewRat(1000, 1))
+	q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if c := new(big.Int).Lsh(new(big.Int).Abs(m), 1).Cmp(r.Denom()); c > 0 || (c == 0 && q.Bit(0) == 1) {
+		q.Add(q, big.NewInt(int64(r.Num().Sign())))
+	}
+	if !q.IsInt64() {
+		return 0, errors.Errorf("decimal %s out of range", n)
+	}
+	return Decimal(q.Int64()), nil
+}
+
+func FuzzParseList(f *testing.F) {
+	fuzzStructuredField(f, "list")
+}
+
+func FuzzParseDictionary(f *testing.F) {
+	fuzzStructuredField(f, "dictionary")
+}
+
+func FuzzParseItem(f *testing.F) {
+	fuzzStructuredField(f, "item")
+}
+
+// fuzzStructuredField checks that a parsed value serializes to a value which parses to the same serialization.
+func fuzzStructuredField(f *testing.F, headerType string) {
+	for _, tests := range loadSFTests(f, sfTestsDir) {
+		for _, tt := range tests {
+			f.Add(strings.Join(tt.Raw, ", "))
+		}
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		v, err := parseSF(headerType, value)
+		if err != nil {
+			return
+		}
+		serialized := v.String()
+		reparsed, err := parseSF(headerType, serialized)
+		require.NoError(t, err, serialized)
+		assert.Equal(t, serialized, reparsed.String())
+	})
+}
+
+func TestNormalise(t *testing.T) {
+	tests := []struct {
+		header string
+		values []string
+		keys   []string
+		normal []string
+	}{
+		{header: "Accept", values: []string{"text/html;q=0.9, application/json"}, keys: []string{"accept"}, normal: []string{"text/html;q=0.9, application/json"}},
+		{header: "Accept", values: []string{" text/html ", "application/json; q=0.5"}, keys: []string{"accept"}, normal: []string{"text/html, application/json;q=0.5"}},
+		{header: "Content-Type", values: []string{"application/json; charset=utf-8"}, keys: []string{"content-type"}, normal: []string{"application/json;charset=utf-8"}},
+		{header: "If-Modified-Since", values: []string{"Tue, 15 Nov 1994 08:12:31 GMT"}, keys: []string{"if-modified-since"}, normal: []string{"Tue, 15 Nov 1994 08:12:31 GMT"}},
+		{header: "X-Dict", values: []string{"b=2;x, a=\"s\", c=(1 2)"}, keys: []string{"x-dict:b", "x-dict:a", "x-dict:c"}, normal: []string{"2;x", `"s"`, "(1 2)"}},
+		{header: "X-List", values: []string{"(a  \"b\");p=?0"}, keys: []string{"x-list:0", "x-list:1", "x-list:2"}, normal: []string{"();p=?0", "(a);p=?0", `(a "b");p=?0`}},
+		{header: "Content-Digest", values: []string{"sha-256=:AAAA:"}, keys: []string{"content-digest:sha-256"}, normal: []string{":AAAA:"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			keys, values, err := Normalise(tt.header, tt.values)
+			require.NoError(t, err)
+			assert.Equal(t, tt.keys, keys)
+			assert.Equal(t, tt.normal, values)
+		})
+	}
+
+	_, _, err := Normalise("X:Header", []string{"1"})
+	assert.ErrorIs(t, err, ErrWrongKeySymbol)
+}
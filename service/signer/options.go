@@ -0,0 +1,49 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"github.com/upvestco/httpsignature-proxy/config"
+	"github.com/upvestco/httpsignature-proxy/service/signer/material"
+)
+
+// NewMaterialOptions builds the material settings of the key configuration.
+func NewMaterialOptions(cfg *config.BaseConfig) (*material.Options, error) {
+	profile, err := material.GetProfile(cfg.SigningProfile)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := material.NewDigest(cfg.DigestAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	for _, component := range append(append([]string{}, cfg.CoveredComponents...), cfg.RequiredComponents...) {
+		if _, err := material.ParseComponent(component); err != nil {
+			return nil, err
+		}
+	}
+	return &material.Options{
+		Profile:            profile,
+		Components:         cfg.CoveredComponents,
+		ExcludedComponents: cfg.ExcludedComponents,
+		RequiredComponents: cfg.RequiredComponents,
+		Lifetime:           cfg.SignatureLifetime,
+		Clock:              material.NewClock(cfg.ClockOffset),
+		Nonce:              material.NumericNonce(cfg.NonceLength),
+		Digest:             digest,
+	}, nil
+}
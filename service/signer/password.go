@@ -0,0 +1,68 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
+)
+
+// ReadPassword returns the private key password from the password file or the output of the
+// password command, the trailing new line is removed. It returns the empty string without both.
+// The command runs in the shell like the signer command, so the password manager invocations can use quotes.
+func ReadPassword(passwordFile, passwordCommand string) (string, error) {
+	switch {
+	case passwordFile != "":
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return "", errors.Wrap(err, "read password file")
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case passwordCommand != "":
+		cmd := shellCommand(context.Background(), passwordCommand)
+		stderr := new(bytes.Buffer)
+		cmd.Stderr = stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", errors.Wrapf(err, "password command: %s", strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+	}
+	return "", nil
+}
+
+// KeyNeedsPassword reports that the PEM encoded private key is encrypted.
+func KeyNeedsPassword(keyData []byte) bool {
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return false
+	}
+	if block.Type == schema.EncryptedPkcs8KeyType {
+		return true
+	}
+	_, err := ssh.ParseRawPrivateKey(keyData)
+	var missing *ssh.PassphraseMissingError
+	return errors.As(err, &missing)
+}
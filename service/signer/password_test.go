@@ -0,0 +1,69 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
+)
+
+func TestReadPassword(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(file, []byte(testPass+"\n"), 0o600))
+
+	password, err := ReadPassword(file, "")
+	require.NoError(t, err)
+	assert.Equal(t, testPass, password)
+
+	if runtime.GOOS != "windows" {
+		password, err = ReadPassword("", "echo '"+testPass+"'")
+		require.NoError(t, err)
+		assert.Equal(t, testPass, password)
+
+		_, err = ReadPassword("", "exit 1")
+		assert.Error(t, err)
+	}
+
+	password, err = ReadPassword("", "")
+	require.NoError(t, err)
+	assert.Empty(t, password)
+}
+
+func TestKeyNeedsPassword(t *testing.T) {
+	_, pk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(pk)
+	require.NoError(t, err)
+	encrypted, err := ssh.MarshalPrivateKeyWithPassphrase(pk, "", []byte(testPass))
+	require.NoError(t, err)
+
+	assert.False(t, KeyNeedsPassword(pem.EncodeToMemory(&pem.Block{Type: schema.Pkcs8KeyType, Bytes: pkcs8})))
+	assert.True(t, KeyNeedsPassword(pem.EncodeToMemory(encrypted)))
+	assert.True(t, KeyNeedsPassword(pem.EncodeToMemory(&pem.Block{Type: schema.EncryptedPkcs8KeyType, Bytes: []byte{0}})))
+}
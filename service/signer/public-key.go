@@ -0,0 +1,80 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
+)
+
+const publicKeyType = "PUBLIC KEY"
+
+func NewVerifierFromFile(fileName string) (*schema.Verifier, error) {
+	body, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return NewVerifier(body)
+}
+
+// NewVerifier accepts a PEM "PUBLIC KEY", an OpenSSH authorized key line or
+// a base64 encoded raw ed25519 public key.
+func NewVerifier(keyData []byte) (*schema.Verifier, error) {
+	keyData = bytes.TrimSpace(keyData)
+	if block, _ := pem.Decode(keyData); block != nil {
+		if block.Type != publicKeyType {
+			return nil, errors.Errorf("unsupported public key type %s", block.Type)
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "ParsePKIXPublicKey")
+		}
+		return newVerifier(pub)
+	}
+	if sshPub, _, _, _, err := ssh.ParseAuthorizedKey(keyData); err == nil {
+		cryptoPub, ok := sshPub.(ssh.CryptoPublicKey)
+		if !ok {
+			return nil, errors.New("unsupported ssh public key")
+		}
+		return newVerifier(cryptoPub.CryptoPublicKey())
+	}
+	raw, err := base64.StdEncoding.DecodeString(string(keyData))
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, errors.New("public key is neither PEM, OpenSSH nor base64 ed25519 key")
+	}
+	return newVerifier(ed25519.PublicKey(raw))
+}
+
+func newVerifier(pub interface{}) (*schema.Verifier, error) {
+	switch pub.(type) {
+	case *ecdsa.PublicKey:
+		return &schema.Verifier{Algo: schema.AlgoECDSA, Pub: pub}, nil
+	case ed25519.PublicKey:
+		return &schema.Verifier{Algo: schema.AlgoEd25519, Pub: pub}, nil
+	}
+	return nil, errors.New("public key is neither ecdsa nor ed25519 key")
+}
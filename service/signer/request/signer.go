@@ -29,6 +29,7 @@ type Signer interface {
 }
 
 type RequestSigner interface {
+	MaterialOptions() *material.Options
 	SignRequest(m *material.Material, r *http.Request, log logger.Logger) error
 }
 
@@ -38,18 +39,41 @@ func New(log logger.Logger) Signer {
 	}
 }
 
+// NewWithExplain returns the signer which prints the explanation of the signature base of every
+// request in the format, see material.ExplainFormats.
+func NewWithExplain(log logger.Logger, format string) Signer {
+	return &requestSigner{
+		log:     log,
+		explain: format,
+	}
+}
+
 type requestSigner struct {
-	log logger.Logger
+	log     logger.Logger
+	explain string
 }
 
 func (e requestSigner) Sign(req *http.Request, s RequestSigner) error {
-	m, err := material.MaterialFromRequest(req)
+	m, err := material.MaterialFromRequest(req, s.MaterialOptions())
 	if err != nil {
 		return errors.Wrap(err, "MaterialFromRequest")
 	}
 	ll := e.log
-	if len(req.Header.Get(logger.HttpProxyNoLogging)) > 0 {
+	noLogging := len(req.Header.Get(logger.HttpProxyNoLogging)) > 0
+	if noLogging {
 		ll = logger.NoVerboseLogger
 	}
-	return errors.Wrap(s.SignRequest(m, req, ll), "AddSignatureHeaders SignRequest")
+	// the explanation is printed, not logged, so it is left out for the requests without logging
+	m.Explaining = e.explain != "" && !noLogging
+	if err := s.SignRequest(m, req, ll); err != nil {
+		return errors.Wrap(err, "AddSignatureHeaders SignRequest")
+	}
+	if m.Explaining {
+		out, err := material.FormatExplanations(e.explain, m.Explanations)
+		if err != nil {
+			return errors.Wrap(err, "explain")
+		}
+		ll.PrintLn(out)
+	}
+	return nil
 }
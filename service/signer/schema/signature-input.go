@@ -0,0 +1,105 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/upvestco/httpsignature-proxy/service/signer/material"
+)
+
+var (
+	ErrWrongSignatureInput = errors.New("wrong signature input")
+	ErrWrongSignature      = errors.New("wrong signature")
+)
+
+// SignatureInput is a single member of the Signature-Input header.
+type SignatureInput struct {
+	Label      string
+	Components []material.Component
+	KeyID      string
+	Created    int64
+	Expires    int64
+	Nonce      string
+	// Params is the serialized member, the value of the @signature-params component.
+	Params string
+}
+
+// ParseSignatureInputs parses the Signature-Input header value and returns the members in the header order.
+func ParseSignatureInputs(value string) ([]SignatureInput, error) {
+	dict, err := material.ParseDictionary(value)
+	if err != nil {
+		return nil, errors.WithMessage(ErrWrongSignatureInput, err.Error())
+	}
+	res := make([]SignatureInput, 0, len(dict))
+	for _, member := range dict {
+		list, ok := member.Member.(material.InnerList)
+		if !ok {
+			return nil, errors.WithMessagef(ErrWrongSignatureInput, "%s is not an inner list", member.Key)
+		}
+		input := SignatureInput{
+			Label:  member.Key,
+			Params: list.String(),
+		}
+		for _, item := range list.Items {
+			name, ok := item.Value.(string)
+			if !ok {
+				return nil, errors.WithMessagef(ErrWrongSignatureInput, "%s: component is not a string", member.Key)
+			}
+			input.Components = append(input.Components, material.Component{Name: name, Params: item.Params})
+		}
+		for _, param := range list.Params {
+			ok := true
+			switch param.Key {
+			case "keyid":
+				input.KeyID, ok = param.Value.(string)
+			case "nonce":
+				input.Nonce, ok = param.Value.(string)
+			case "created":
+				input.Created, ok = param.Value.(int64)
+			case "expires":
+				input.Expires, ok = param.Value.(int64)
+			}
+			if !ok {
+				return nil, errors.WithMessagef(ErrWrongSignatureInput, "%s: invalid %s", member.Key, param.Key)
+			}
+		}
+		res = append(res, input)
+	}
+	return res, nil
+}
+
+// ParseSignatures parses the Signature header value into the signature bytes by label.
+func ParseSignatures(value string) (map[string][]byte, error) {
+	dict, err := material.ParseDictionary(value)
+	if err != nil {
+		return nil, errors.WithMessage(ErrWrongSignature, err.Error())
+	}
+	res := make(map[string][]byte)
+	for _, member := range dict {
+		item, ok := member.Member.(material.Item)
+		if !ok {
+			return nil, errors.WithMessagef(ErrWrongSignature, "%s is not a byte sequence", member.Key)
+		}
+		sig, ok := item.Value.([]byte)
+		if !ok {
+			return nil, errors.WithMessagef(ErrWrongSignature, "%s is not a byte sequence", member.Key)
+		}
+		res[member.Key] = sig
+	}
+	return res, nil
+}
@@ -36,18 +36,26 @@ type SigningSchemeBuilder interface {
 	GetDefaultPrivateKey() *Sign
 }
 
+// MessageSigner signs the signature base with a private key kept outside of the proxy memory,
+// e.g. in an ssh-agent. A Sign with a MessageSigner as Pk delegates the signing to it, the
+// returned bytes must be the signature in the format of the Sign algorithm.
+type MessageSigner interface {
+	SignMessage(message []byte) ([]byte, error)
+}
+
 const (
 	algoEd25519 = "Ed25519"
 	algoECDSA   = "ECDSA"
 )
 
 const (
-	AlgoECDSA = "ECDSA"
-	EcKeyType = "EC PRIVATE KEY"
-)
+	AlgoECDSA   = algoECDSA
+	AlgoEd25519 = algoEd25519
 
-const (
-	signingVersion = "15"
+	EcKeyType             = "EC PRIVATE KEY"
+	Pkcs8KeyType          = "PRIVATE KEY"
+	EncryptedPkcs8KeyType = "ENCRYPTED PRIVATE KEY"
+	OpenSSHKeyType        = "OPENSSH PRIVATE KEY"
 )
 
 var (
@@ -56,10 +64,18 @@ var (
 )
 
 type Sign struct {
-	KeyID string
-	Algo  string
-	Pk    interface{}
-	Pub   interface{}
+	KeyID   string
+	Algo    string
+	Pk      interface{}
+	Pub     interface{}
+	Options *material.Options
+	// Next keys sign the same components in addition to this key, so a new key can be
+	// tested in parallel before the current one is retired. Their options are ignored.
+	Next []*Sign
+}
+
+func (e *Sign) MaterialOptions() *material.Options {
+	return e.Options
 }
 
 func (e *Sign) SignRequest(m *material.Material, r *http.Request, log logger.Logger) error {
@@ -67,26 +83,41 @@ func (e *Sign) SignRequest(m *material.Material, r *http.Request, log logger.Log
 }
 
 func (e *Sign) sign(m *material.Material, headers http.Header, log logger.Logger) error {
-	const sigID = "sig1"
-	body, signatureParams, err := m.GetBody(e.KeyID)
+	keys := append([]*Sign{e}, e.Next...)
+	inputs := make([]string, 0, len(keys))
+	signatures := make([]string, 0, len(keys))
+	var body []byte
+	for i, key := range keys {
+		sigID := fmt.Sprintf("sig%d", i+1)
+		var signatureParams string
+		var err error
+		body, signatureParams, err = m.GetBody(key.KeyID)
+		if err != nil {
+			return errors.Wrap(err, "GetBody")
+		}
+		signBytes, err := key.calculateSignBytes(body)
+		if err != nil {
+			return errors.Wrapf(err, "calculateSignBytes %s", key.KeyID)
+		}
+		hash := b64.StdEncoding.EncodeToString(signBytes)
+		if m.Explaining {
+			m.Explanations = append(m.Explanations, m.Explain(sigID, key.KeyID, signatureParams))
+		}
+		inputs = append(inputs, fmt.Sprintf("%s=%s", sigID, signatureParams))
+		signatures = append(signatures, fmt.Sprintf("%s=:%s:", sigID, hash))
 
-	if err != nil {
-		return errors.Wrap(err, "GetBody")
+		log.LogF(" - Signature '%s' with keyID '%s'", sigID, key.KeyID)
 	}
-	signBytes, err := e.calculateSignBytes(body)
-	if err != nil {
-		return errors.Wrap(err, "calculateSignBytes")
-	}
-	hash := b64.StdEncoding.EncodeToString(signBytes)
 
-	headers.Set(material.SignatureInputHeader, fmt.Sprintf("%s=%s", sigID, signatureParams))
-	headers.Set(material.SignatureHeader, fmt.Sprintf("%s=:%s:", sigID, hash))
-	headers.Set(material.SignatureHeader, fmt.Sprintf("%s=:%s:", sigID, hash))
-	headers.Set(material.SigningVersionHeader, signingVersion)
+	headers.Set(material.SignatureInputHeader, strings.Join(inputs, ", "))
+	headers.Set(material.SignatureHeader, strings.Join(signatures, ", "))
 
-	log.LogF(" - Header '%s' added with value '%s'", material.SignatureInputHeader, signatureParams)
-	log.LogF(" - Header '%s' added with value '%s'", material.SignatureHeader, hash)
-	log.LogF(" - Header '%s' added with value '%s'", material.SigningVersionHeader, signingVersion)
+	log.LogF(" - Header '%s' added with value '%s'", material.SignatureInputHeader, headers.Get(material.SignatureInputHeader))
+	log.LogF(" - Header '%s' added with value '%s'", material.SignatureHeader, headers.Get(material.SignatureHeader))
+	if version := m.Profile.Version(); version != "" {
+		headers.Set(material.SigningVersionHeader, version)
+		log.LogF(" - Header '%s' added with value '%s'", material.SigningVersionHeader, version)
+	}
 
 	log.Log(" - Headers list:")
 	for key, vals := range headers {
@@ -101,6 +132,9 @@ func (e *Sign) sign(m *material.Material, headers http.Header, log logger.Logger
 }
 
 func (e *Sign) calculateSignBytes(message []byte) ([]byte, error) {
+	if signer, ok := e.Pk.(MessageSigner); ok {
+		return signer.SignMessage(message)
+	}
 	var signBytes []byte
 	var err error
 	switch e.Algo {
@@ -0,0 +1,252 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/upvestco/httpsignature-proxy/service/signer/material"
+)
+
+var (
+	ErrNoSignature    = errors.New("request has no signature")
+	errWrongPublicKey = errors.New("wrong public key")
+)
+
+// Verifier checks the signatures created by Sign with the matching public key.
+type Verifier struct {
+	Algo    string
+	Pub     interface{}
+	Options *material.Options
+	Now     func() time.Time
+}
+
+// VerificationReport describes the result of the verification of one signature.
+type VerificationReport struct {
+	Label            string
+	KeyID            string
+	Components       []string
+	MissingComponent []string
+	Created          time.Time
+	Expires          time.Time
+	NotYetValid      bool
+	Expired          bool
+	ReceivedDigest   string
+	ExpectedDigest   string
+	SignatureBase    []byte
+	SignatureError   error
+}
+
+// DigestMismatch reports that the Content-Digest header does not match the body.
+func (r *VerificationReport) DigestMismatch() bool {
+	return r.ReceivedDigest != r.ExpectedDigest
+}
+
+// Valid reports that the signature matches and all the checks are passed.
+func (r *VerificationReport) Valid() bool {
+	return r.SignatureError == nil && !r.DigestMismatch() && !r.Expired && !r.NotYetValid &&
+		len(r.MissingComponent) == 0
+}
+
+// Problems lists the failed checks in a short form, it is empty for a valid signature.
+func (r *VerificationReport) Problems() []string {
+	res := make([]string, 0)
+	if r.SignatureError != nil {
+		res = append(res, r.SignatureError.Error())
+	}
+	if len(r.MissingComponent) > 0 {
+		res = append(res, "missing components "+strings.Join(r.MissingComponent, ", "))
+	}
+	if r.DigestMismatch() {
+		res = append(res, "content-digest mismatch")
+	}
+	if r.NotYetValid {
+		res = append(res, "created in the future")
+	}
+	if r.Expired {
+		res = append(res, "expired")
+	}
+	return res
+}
+
+// MismatchedComponents compares the signature base with the one produced by the client
+// and returns the names of the components with different values.
+func (r *VerificationReport) MismatchedComponents(expectedBase []byte) []string {
+	expected := splitBase(expectedBase)
+	actual := splitBase(r.SignatureBase)
+	res := make([]string, 0)
+	for name, v := range actual {
+		if ev, ok := expected[name]; !ok || ev != v {
+			res = append(res, name)
+		}
+	}
+	for name := range expected {
+		if _, ok := actual[name]; !ok {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func splitBase(base []byte) map[string]string {
+	res := make(map[string]string)
+	for _, line := range strings.Split(strings.ReplaceAll(string(base), "\r\n", "\n"), "\n") {
+		if name, v, ok := strings.Cut(line, ": "); ok {
+			res[strings.Trim(name, `"`)] = v
+		}
+	}
+	return res
+}
+
+// VerifyDump reads a raw HTTP request and verifies its signatures.
+func (v *Verifier) VerifyDump(dump io.Reader) ([]*VerificationReport, error) {
+	req, err := http.ReadRequest(bufio.NewReader(dump))
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadRequest")
+	}
+	return v.VerifyRequest(req)
+}
+
+// VerifyRequest rebuilds the signature base of every signature of the request and verifies it.
+func (v *Verifier) VerifyRequest(req *http.Request) ([]*VerificationReport, error) {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	return v.VerifyRequestAt(req, now)
+}
+
+// VerifyRequestAt verifies the request like VerifyRequest, with the validity of the signatures
+// checked at the time the request was received instead of now.
+func (v *Verifier) VerifyRequestAt(req *http.Request, at time.Time) ([]*VerificationReport, error) {
+	inputs, err := ParseSignatureInputs(strings.Join(req.Header.Values(material.SignatureInputHeader), ", "))
+	if err != nil {
+		return nil, errors.Wrap(err, "ParseSignatureInputs")
+	}
+	if len(inputs) == 0 {
+		return nil, ErrNoSignature
+	}
+	signatures, err := ParseSignatures(strings.Join(req.Header.Values(material.SignatureHeader), ", "))
+	if err != nil {
+		return nil, errors.Wrap(err, "ParseSignatures")
+	}
+	body, err := material.GetRequestBody(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetRequestBody")
+	}
+
+	// CollectFromRequest replaces the Content-Digest header, so it works on a copy
+	received := req.Header.Get(material.ContentDigestHeader)
+	cp := req.Clone(req.Context())
+	cp.Body = io.NopCloser(bytes.NewReader(body))
+	cp.GetBody = nil
+	m, err := material.CollectFromRequest(cp, v.Options)
+	if err != nil {
+		return nil, errors.Wrap(err, "CollectFromRequest")
+	}
+	if len(received) > 0 {
+		m.Data[material.ContentDigestComponent] = received
+	}
+
+	reports := make([]*VerificationReport, 0, len(inputs))
+	for _, input := range inputs {
+		reports = append(reports, v.verify(input, signatures[input.Label], req, m, body, received, at))
+	}
+	return reports, nil
+}
+
+func (v *Verifier) verify(input SignatureInput, signature []byte, req *http.Request, m *material.Material, body []byte, receivedDigest string,
+	now time.Time) *VerificationReport {
+	report := &VerificationReport{
+		Label:          input.Label,
+		KeyID:          input.KeyID,
+		Created:        time.Unix(input.Created, 0),
+		Expires:        time.Unix(input.Expires, 0),
+		ReceivedDigest: receivedDigest,
+	}
+	report.NotYetValid = report.Created.After(now)
+	report.Expired = input.Expires > 0 && report.Expires.Before(now)
+	if len(body) > 0 || len(receivedDigest) > 0 {
+		report.ExpectedDigest = material.ExpectedContentDigest(receivedDigest, body)
+	}
+
+	rebuilt := &material.Material{
+		Data:    make(map[string]string),
+		Names:   input.Components,
+		Profile: m.Profile,
+	}
+	for _, c := range input.Components {
+		name := c.String()
+		report.Components = append(report.Components, name)
+		value, ok := m.Data[name]
+		if len(c.Params) > 0 {
+			var err error
+			if value, ok, err = material.ComponentValue(c, req); err != nil {
+				ok = false
+			}
+		}
+		if !ok {
+			report.MissingComponent = append(report.MissingComponent, name)
+		}
+		rebuilt.Data[name] = value
+	}
+	report.SignatureBase = m.Profile.SignatureBase(rebuilt, input.Params)
+
+	if signature == nil {
+		report.SignatureError = errors.Errorf("no signature with label %s", input.Label)
+		return report
+	}
+	report.SignatureError = v.verifySignature(report.SignatureBase, signature)
+	return report
+}
+
+func (v *Verifier) verifySignature(message, signature []byte) error {
+	switch v.Algo {
+	case algoEd25519:
+		pub, ok := v.Pub.(ed25519.PublicKey)
+		if !ok {
+			return errors.Wrap(errWrongPublicKey, "not a ed25519.PublicKey")
+		}
+		if !ed25519.Verify(pub, message, signature) {
+			return ErrWrongSignature
+		}
+	case algoECDSA:
+		pub, ok := v.Pub.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.Wrap(errWrongPublicKey, "not a ecdsa.PublicKey")
+		}
+		hash := sha512.Sum512(message)
+		if !ecdsa.VerifyASN1(pub, hash[:], signature) {
+			return ErrWrongSignature
+		}
+	default:
+		return errUnsupportedAlgorithm
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/upvestco/httpsignature-proxy/service/logger"
+	"github.com/upvestco/httpsignature-proxy/service/signer/material"
+	"github.com/upvestco/httpsignature-proxy/service/signer/request"
+)
+
+const testKeyID = "key_id"
+
+func newSignedRequest(t *testing.T, sign *Sign, body string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "http://localhost/endpoint?param=val", bytes.NewBufferString(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/plain")
+	require.NoError(t, request.New(logger.New(false)).Sign(req, sign))
+	return req
+}
+
+func newTestKeys(t *testing.T) (*Sign, *Verifier) {
+	t.Helper()
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return &Sign{KeyID: testKeyID, Algo: AlgoECDSA, Pk: pk},
+		&Verifier{Algo: AlgoECDSA, Pub: &pk.PublicKey}
+}
+
+func TestVerifier_VerifyRequest(t *testing.T) {
+	pub, pk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecSign, ecVerifier := newTestKeys(t)
+	rfc9421 := &material.Options{Profile: material.RFC9421Profile{}}
+	params := &material.Options{Profile: material.RFC9421Profile{}, Components: []string{"@method", "accept;sf", "content-type;bs", "content-digest"}}
+
+	tests := []struct {
+		name     string
+		sign     *Sign
+		verifier *Verifier
+	}{
+		{name: "ecdsa", sign: ecSign, verifier: ecVerifier},
+		{name: "ed25519", sign: &Sign{KeyID: testKeyID, Algo: AlgoEd25519, Pk: &pk}, verifier: &Verifier{Algo: AlgoEd25519, Pub: pub}},
+		{
+			name:     "rfc9421 profile",
+			sign:     &Sign{KeyID: testKeyID, Algo: AlgoEd25519, Pk: &pk, Options: rfc9421},
+			verifier: &Verifier{Algo: AlgoEd25519, Pub: pub, Options: rfc9421},
+		},
+		{
+			name:     "component parameters",
+			sign:     &Sign{KeyID: testKeyID, Algo: AlgoEd25519, Pk: &pk, Options: params},
+			verifier: &Verifier{Algo: AlgoEd25519, Pub: pub, Options: params},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newSignedRequest(t, tt.sign, `{"a":1}`)
+
+			reports, err := tt.verifier.VerifyRequest(req)
+			require.NoError(t, err)
+			require.Len(t, reports, 1)
+			assert.True(t, reports[0].Valid(), reports[0].SignatureError)
+			assert.Equal(t, "sig1", reports[0].Label)
+			assert.Equal(t, testKeyID, reports[0].KeyID)
+			assert.False(t, reports[0].DigestMismatch())
+		})
+	}
+}
+
+func TestVerifier_VerifyDump(t *testing.T) {
+	sign, verifier := newTestKeys(t)
+	req := newSignedRequest(t, sign, `{"a":1}`)
+	dump, err := httputil.DumpRequestOut(req, true)
+	require.NoError(t, err)
+
+	reports, err := verifier.VerifyDump(bytes.NewReader(dump))
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	assert.True(t, reports[0].Valid(), reports[0].SignatureError)
+}
+
+func TestVerifier_ReportsMismatches(t *testing.T) {
+	sign, verifier := newTestKeys(t)
+
+	t.Run("tampered body", func(t *testing.T) {
+		req := newSignedRequest(t, sign, `{"a":1}`)
+		req.Body = nil
+		req.GetBody = func() (rc io.ReadCloser, err error) { return io.NopCloser(strings.NewReader(`{"a":2}`)), nil }
+
+		reports, err := verifier.VerifyRequest(req)
+		require.NoError(t, err)
+		assert.False(t, reports[0].Valid())
+		assert.True(t, reports[0].DigestMismatch())
+		assert.NoError(t, reports[0].SignatureError)
+	})
+
+	t.Run("tampered header", func(t *testing.T) {
+		req := newSignedRequest(t, sign, `{"a":1}`)
+		origBase := signatureBase(t, verifier, req)
+		req.Header.Set("Content-Type", "text/plain")
+
+		reports, err := verifier.VerifyRequest(req)
+		require.NoError(t, err)
+		assert.ErrorIs(t, reports[0].SignatureError, ErrWrongSignature)
+		assert.Equal(t, []string{"content-type"}, reports[0].MismatchedComponents(origBase))
+	})
+
+	t.Run("missing header", func(t *testing.T) {
+		req := newSignedRequest(t, sign, `{"a":1}`)
+		req.Header.Del("Accept")
+
+		reports, err := verifier.VerifyRequest(req)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"accept"}, reports[0].MissingComponent)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		req := newSignedRequest(t, sign, `{"a":1}`)
+		expired := *verifier
+		expired.Now = func() time.Time { return time.Now().Add(time.Hour) }
+
+		reports, err := expired.VerifyRequest(req)
+		require.NoError(t, err)
+		assert.True(t, reports[0].Expired)
+		assert.NoError(t, reports[0].SignatureError)
+		assert.False(t, reports[0].Valid())
+	})
+}
+
+func signatureBase(t *testing.T, verifier *Verifier, req *http.Request) []byte {
+	t.Helper()
+	reports, err := verifier.VerifyRequest(req)
+	require.NoError(t, err)
+	return reports[0].SignatureBase
+}
+
+func TestSign_NextKeys(t *testing.T) {
+	sign, verifier := newTestKeys(t)
+	next, nextVerifier := newTestKeys(t)
+	next.KeyID = "next_key_id"
+	sign.Next = []*Sign{next}
+
+	req := newSignedRequest(t, sign, `{"a":1}`)
+
+	reports, err := verifier.VerifyRequest(req)
+	require.NoError(t, err)
+	require.Len(t, reports, 2)
+	assert.Equal(t, "sig1", reports[0].Label)
+	assert.Equal(t, testKeyID, reports[0].KeyID)
+	assert.True(t, reports[0].Valid(), reports[0].SignatureError)
+	assert.Equal(t, reports[0].Components, reports[1].Components)
+
+	reports, err = nextVerifier.VerifyRequest(req)
+	require.NoError(t, err)
+	assert.Equal(t, "sig2", reports[1].Label)
+	assert.Equal(t, "next_key_id", reports[1].KeyID)
+	assert.True(t, reports[1].Valid(), reports[1].SignatureError)
+	assert.False(t, reports[0].Valid())
+}
+
+// printLogger keeps the printed lines, the verbose logs are dropped.
+type printLogger struct {
+	lines []string
+}
+
+func (l *printLogger) Log(string)                    {}
+func (l *printLogger) LogF(string, ...interface{})   {}
+func (l *printLogger) PrintF(string, ...interface{}) {}
+func (l *printLogger) PrintLn(message string) {
+	l.lines = append(l.lines, message)
+}
+
+func TestSign_Explain(t *testing.T) {
+	sign, _ := newTestKeys(t)
+	newRequest := func() *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost/endpoint?param=val", bytes.NewBufferString(`{"a":1}`))
+		require.NoError(t, err)
+		return req
+	}
+
+	req := newRequest()
+	m, err := material.MaterialFromRequest(req, sign.MaterialOptions())
+	require.NoError(t, err)
+	require.NoError(t, sign.SignRequest(m, req, logger.NoVerboseLogger))
+	assert.Empty(t, m.Explanations)
+
+	ll := &printLogger{}
+	require.NoError(t, request.NewWithExplain(ll, material.ExplainJSON).Sign(newRequest(), sign))
+	require.Len(t, ll.lines, 1)
+	var explanations []material.Explanation
+	require.NoError(t, json.Unmarshal([]byte(ll.lines[0]), &explanations))
+	require.Len(t, explanations, 1)
+	assert.Equal(t, http.MethodPost, explanations[0].Method)
+	assert.Equal(t, "http://localhost/endpoint?param=val", explanations[0].TargetURI)
+
+	ll = &printLogger{}
+	req = newRequest()
+	req.Header.Set(logger.HttpProxyNoLogging, "true")
+	require.NoError(t, request.NewWithExplain(ll, material.ExplainJSON).Sign(req, sign))
+	assert.Empty(t, ll.lines)
+}
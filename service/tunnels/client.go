@@ -22,8 +22,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -43,13 +45,28 @@ type ApiClient interface {
 	TunnelIsReady(context.Context) error
 }
 
+// unixSocketPrefix starts the proxy address of a proxy listening on a unix socket.
+const unixSocketPrefix = "unix:"
+
+// NewClient returns the client of the Upvest API through the proxy at the address, an http URL or
+// unix:/path when the proxy listens on a unix socket.
 func NewClient(proxyAddress string, usersCredentials UserCredentials, timeout time.Duration) ApiClient {
+	httpClient := http.Client{
+		Timeout: timeout,
+	}
+	if path, ok := strings.CutPrefix(proxyAddress, unixSocketPrefix); ok {
+		proxyAddress = "http://localhost"
+		httpClient.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+	}
 	return &apiClient{
 		proxyAddress:     proxyAddress,
 		usersCredentials: usersCredentials,
-		httpClient: http.Client{
-			Timeout: timeout,
-		},
+		httpClient:       httpClient,
 	}
 }
 
@@ -31,6 +31,8 @@ import (
 	colorjson "github.com/neilotoole/jsoncolor"
 	"github.com/pkg/errors"
 	"github.com/upvestco/httpsignature-proxy/service/logger"
+	"github.com/upvestco/httpsignature-proxy/service/signer/material"
+	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
 	"github.com/upvestco/httpsignature-proxy/service/ui"
 	"golang.org/x/exp/maps"
 	"golang.org/x/exp/rand" //nolint:staticcheck
@@ -52,10 +54,13 @@ type tunnel struct {
 	eventsFilter map[string]interface{}
 	logger       logger.Logger
 	logHeaders   bool
+	verifyDigest bool
+	verifier     *schema.Verifier
+	endpoint     string
 	cancel       context.CancelFunc
 }
 
-func createTunnel(apiClient ApiClient, events []string, logHeaders bool, logger logger.Logger) *tunnel {
+func createTunnel(apiClient ApiClient, events []string, logHeaders, verifyDigest bool, verifier *schema.Verifier, logger logger.Logger) *tunnel {
 	eventsFilter := map[string]interface{}{}
 	for _, t := range events {
 		if len(t) == 0 {
@@ -69,6 +74,8 @@ func createTunnel(apiClient ApiClient, events []string, logHeaders bool, logger
 		eventsFilter: eventsFilter,
 		logger:       logger,
 		logHeaders:   logHeaders,
+		verifyDigest: verifyDigest,
+		verifier:     verifier,
 	}
 }
 
@@ -114,6 +121,16 @@ func (e *tunnel) pullEvents(ctx context.Context, endpointID string) error {
 	}
 
 	for _, item := range items {
+		if e.verifyDigest {
+			e.checkDigest(item)
+		}
+		if e.verifier != nil {
+			item.Verification = e.verifySignature(item)
+			if item.Verification.Status == ui.SignatureInvalid {
+				e.logger.PrintLn(lightRed("Webhook event received at %s failed signature verification: %s",
+					item.CreatedAt.Format(time.DateTime), item.Verification.Message))
+			}
+		}
 		if ui.IsCreated() {
 			ui.AddPayload(item, e.eventsFilter)
 		} else {
@@ -132,6 +149,9 @@ func (e *tunnel) consoleLog(item ui.PullItem) {
 
 	e.logger.PrintLn(cyan("== new webhook event received == "))
 	e.logger.PrintLn(cyan("== received at: %s", item.CreatedAt.Format(time.DateTime)))
+	if item.Verification.Status != ui.NotVerified {
+		e.logger.PrintLn(cyan("== signature: %s %s", item.Verification.Badge(), item.Verification.Message))
+	}
 	if e.logHeaders {
 		e.printHeaders(item, filtered)
 	}
@@ -144,6 +164,45 @@ func (e *tunnel) consoleLog(item ui.PullItem) {
 
 }
 
+// verifySignature checks the signatures of the webhook delivery with the Upvest public key. The delivery
+// is rebuilt as the POST request to the tunnel endpoint, which Upvest has signed. The signatures are
+// checked at the time the delivery was received, as the events may be pulled much later.
+func (e *tunnel) verifySignature(item ui.PullItem) ui.Verification {
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, strings.NewReader(item.Payload))
+	if err != nil {
+		return ui.Verification{Status: ui.SignatureInvalid, Message: err.Error()}
+	}
+	req.Header = item.Headers.Clone()
+	receivedAt := item.CreatedAt
+	if receivedAt.IsZero() {
+		receivedAt = time.Now()
+	}
+	reports, err := e.verifier.VerifyRequestAt(req, receivedAt)
+	if err != nil {
+		return ui.Verification{Status: ui.SignatureInvalid, Message: err.Error()}
+	}
+	problems := make([]string, 0)
+	for _, report := range reports {
+		if report.Valid() {
+			return ui.Verification{Status: ui.SignatureValid, Message: fmt.Sprintf("%s with keyid %q is valid", report.Label, report.KeyID)}
+		}
+		problems = append(problems, fmt.Sprintf("%s with keyid %q: %s", report.Label, report.KeyID, strings.Join(report.Problems(), ", ")))
+	}
+	return ui.Verification{Status: ui.SignatureInvalid, Message: strings.Join(problems, "; ")}
+}
+
+// checkDigest logs the webhook payloads which do not match their Content-Digest header.
+func (e *tunnel) checkDigest(item ui.PullItem) {
+	value := item.Headers.Get(material.ContentDigestHeader)
+	if value == "" {
+		e.logger.LogF("webhook event received at %s has no Content-Digest header", item.CreatedAt.Format(time.DateTime))
+		return
+	}
+	if err := material.VerifyContentDigest(value, []byte(item.Payload)); err != nil {
+		e.logger.PrintLn(lightRed("Webhook event received at %s failed Content-Digest verification: %s", item.CreatedAt.Format(time.DateTime), err.Error()))
+	}
+}
+
 func (e *tunnel) filterAndFormat(payload string) (string, int, int) {
 	if len(payload) == 0 {
 		return "", 0, 0
@@ -222,6 +281,7 @@ func (e *tunnel) start() error {
 		return errors.Wrap(err, "Could not create tunnel.")
 	}
 	e.logger.LogF("backend endpoint (%s) for the client is created", endpoint)
+	e.endpoint = endpoint
 
 	request := WebhookRequest{
 		Title: "http signature webhook " + randomString(8),
@@ -0,0 +1,71 @@
+/*
+Copyright © 2021 Upvest GmbH <support@upvest.co>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnels
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/upvestco/httpsignature-proxy/service/logger"
+	"github.com/upvestco/httpsignature-proxy/service/signer/request"
+	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
+	"github.com/upvestco/httpsignature-proxy/service/ui"
+)
+
+const testEndpoint = "https://tunnels.example.com/endpoints/1"
+
+func TestTunnel_VerifySignature(t *testing.T) {
+	pub, pk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	payload := `{"payload":[{"type":"ORDER.FILLED"}]}`
+
+	req, err := http.NewRequest(http.MethodPost, testEndpoint, bytes.NewBufferString(payload))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	sign := &schema.Sign{KeyID: "upvest", Algo: schema.AlgoEd25519, Pk: &pk}
+	require.NoError(t, request.New(logger.New(false)).Sign(req, sign))
+
+	tn := createTunnel(nil, nil, false, false, &schema.Verifier{Algo: schema.AlgoEd25519, Pub: pub}, logger.New(false))
+	tn.endpoint = testEndpoint
+
+	item := ui.PullItem{Headers: req.Header, Payload: payload, CreatedAt: time.Now()}
+	v := tn.verifySignature(item)
+	assert.Equal(t, ui.SignatureValid, v.Status, v.Message)
+	assert.Contains(t, v.Message, `"upvest"`)
+
+	// the event is shown after the lifetime of the signature, it is checked at its delivery
+	tn.verifier.Now = func() time.Time { return time.Now().Add(time.Hour) }
+	v = tn.verifySignature(item)
+	assert.Equal(t, ui.SignatureValid, v.Status, v.Message)
+
+	item.CreatedAt = time.Now().Add(-time.Hour)
+	v = tn.verifySignature(item)
+	assert.Equal(t, ui.SignatureInvalid, v.Status)
+	assert.Contains(t, v.Message, "created in the future")
+	item.CreatedAt = time.Now()
+
+	item.Payload = `{"payload":[]}`
+	v = tn.verifySignature(item)
+	assert.Equal(t, ui.SignatureInvalid, v.Status)
+	assert.Contains(t, v.Message, "content-digest mismatch")
+}
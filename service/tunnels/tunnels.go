@@ -9,7 +9,9 @@ import (
 	"github.com/gookit/color"
 	colorjson "github.com/neilotoole/jsoncolor"
 	"github.com/pkg/errors"
+	"github.com/upvestco/httpsignature-proxy/config"
 	"github.com/upvestco/httpsignature-proxy/service/logger"
+	"github.com/upvestco/httpsignature-proxy/service/signer/schema"
 	"github.com/upvestco/httpsignature-proxy/service/ui"
 	"golang.org/x/exp/maps"
 )
@@ -33,11 +35,14 @@ type Tunnels struct {
 	cancel          context.CancelFunc
 	tunnels         *tunnelsMap
 	logHeaders      bool
+	verifyDigests   bool
+	verifiers       map[string]*schema.Verifier
+	verifiersLock   sync.RWMutex
 	createApiClient func(credentials UserCredentials) ApiClient
 	proxyAddress    string
 }
 
-func CreateTunnels(logger logger.Logger, events []string, proxyAddress string, createApiClient func(credentials UserCredentials) ApiClient, logHeaders bool) *Tunnels {
+func CreateTunnels(logger logger.Logger, events []string, proxyAddress string, createApiClient func(credentials UserCredentials) ApiClient, logHeaders, verifyDigests bool, verifiers map[string]*schema.Verifier) *Tunnels {
 	if !ui.IsCreated() {
 		if colorjson.IsColorTerminal(os.Stdout) {
 			cyan = color.FgCyan.Sprintf
@@ -51,6 +56,8 @@ func CreateTunnels(logger logger.Logger, events []string, proxyAddress string, c
 		closeGroup:      new(sync.WaitGroup),
 		createApiClient: createApiClient,
 		logHeaders:      logHeaders,
+		verifyDigests:   verifyDigests,
+		verifiers:       verifiers,
 		proxyAddress:    proxyAddress,
 	}
 }
@@ -95,7 +102,7 @@ func (e *Tunnels) Start(userCredentialsCh chan UserCredentials) {
 			if exists {
 				continue
 			}
-			t := createTunnel(e.createApiClient(uc), e.events, e.logHeaders, e.logger)
+			t := createTunnel(e.createApiClient(uc), e.events, e.logHeaders, e.verifyDigests, e.verifier(uc.ClientID), e.logger)
 			e.tunnels.add(uc.ClientID, t)
 			e.closeGroup.Add(1)
 			go func(t *tunnel, uc UserCredentials) {
@@ -109,6 +116,24 @@ func (e *Tunnels) Start(userCredentialsCh chan UserCredentials) {
 	}
 }
 
+// SetVerifiers replaces the webhook signature verifiers after a configuration reload, they
+// apply to the tunnels opened afterwards.
+func (e *Tunnels) SetVerifiers(verifiers map[string]*schema.Verifier) {
+	e.verifiersLock.Lock()
+	defer e.verifiersLock.Unlock()
+	e.verifiers = verifiers
+}
+
+// verifier returns the webhook signature verifier of the client, or the one of the default key config.
+func (e *Tunnels) verifier(clientID string) *schema.Verifier {
+	e.verifiersLock.RLock()
+	defer e.verifiersLock.RUnlock()
+	if v, ok := e.verifiers[clientID]; ok {
+		return v
+	}
+	return e.verifiers[config.DefaultClientKey]
+}
+
 type tunnelsMap struct {
 	tunnels map[string]*tunnel
 	lo      *sync.Mutex
@@ -83,7 +83,7 @@ func AddPayload(payload PullItem, filter map[string]interface{}) {
 				s = "│"
 			}
 		}
-		title := fmt.Sprintf("%s %s %s", s, time.Now().Format(time.DateTime), ev.Type)
+		title := fmt.Sprintf("%s %s %s %s", s, payload.Verification.Badge(), time.Now().Format(time.DateTime), ev.Type)
 		event := NewEvent(id, title, []byte(payload.Payload), payload.Headers)
 		eventsList.Append(event)
 
@@ -344,6 +344,33 @@ type PullItem struct {
 	Headers   http.Header `json:"headers"`
 	Payload   string      `json:"payload"`
 	CreatedAt time.Time   `json:"created_at"`
+	// Verification is the result of the signature check done by the proxy.
+	Verification Verification `json:"-"`
+}
+
+// Verification is the result of the signature check of a webhook event.
+type Verification struct {
+	Status  VerificationStatus
+	Message string
+}
+
+type VerificationStatus int
+
+const (
+	NotVerified VerificationStatus = iota
+	SignatureValid
+	SignatureInvalid
+)
+
+// Badge is shown in front of the event in the events list.
+func (v Verification) Badge() string {
+	switch v.Status {
+	case SignatureValid:
+		return "✔"
+	case SignatureInvalid:
+		return "✘"
+	}
+	return " "
 }
 
 type Payload struct {